@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// bootstrapAdmins makes the existing users listed in ADMIN_EMAILS admins. It
+// only runs at startup: emails aren't verified, so signing up with a listed
+// email must not be enough to become an admin. handlerReset keeps these
+// accounts for the same reason. Other roles are given through the admin
+// endpoints.
+func (cfg *apiConfig) bootstrapAdmins() error {
+	for _, email := range cfg.adminEmails {
+		user, err := cfg.db.GetUserByEmail(email)
+		if err != nil {
+			return fmt.Errorf("couldn't get user %s: %w", email, err)
+		}
+		if user.ID == uuid.Nil || user.Role == database.RoleAdmin {
+			continue
+		}
+		if err := cfg.db.SetUserRole(user.ID, database.RoleAdmin); err != nil {
+			return fmt.Errorf("couldn't make %s an admin: %w", email, err)
+		}
+		log.Printf("Made %s an admin", email)
+	}
+	return nil
+}
@@ -21,18 +21,77 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
   await login();
 });
 
+// authFetch sends a request with the access token. Access tokens are
+// short-lived, so when one is rejected it is refreshed and the request is
+// retried once.
+async function authFetch(url, options = {}) {
+  const send = () =>
+    fetch(url, {
+      ...options,
+      headers: {
+        ...options.headers,
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+
+  const res = await send();
+  if (res.status !== 401 || !(await refreshAccessToken())) {
+    return res;
+  }
+  return send();
+}
+
+let refreshing = null;
+
+// refreshAccessToken trades the refresh token for a new pair. Concurrent
+// callers share one request, since each refresh token can only be used once.
+function refreshAccessToken() {
+  if (!refreshing) {
+    refreshing = doRefresh().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+async function doRefresh() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return false;
+  }
+
+  const res = await fetch('/api/refresh', {
+    method: 'POST',
+    headers: {
+      Authorization: `Bearer ${refreshToken}`,
+    },
+  });
+  if (!res.ok) {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    document.getElementById('auth-section').style.display = 'block';
+    document.getElementById('video-section').style.display = 'none';
+    return false;
+  }
+
+  const data = await res.json();
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refreshToken', data.refresh_token);
+  return true;
+}
+
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const visibility = document.getElementById('video-visibility').value;
 
   try {
-    const res = await fetch('/api/videos', {
+    const res = await authFetch('/api/videos', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -68,6 +127,7 @@ async function login() {
 
     if (data.token) {
       localStorage.setItem('token', data.token);
+      localStorage.setItem('refreshToken', data.refresh_token);
       document.getElementById('auth-section').style.display = 'none';
       document.getElementById('video-section').style.display = 'block';
       await getVideos();
@@ -102,12 +162,37 @@ async function signup() {
   }
 }
 
-function logout() {
+async function logout() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (refreshToken) {
+    await fetch('/api/revoke', {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${refreshToken}`,
+      },
+    }).catch(() => {});
+  }
   localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
   document.getElementById('auth-section').style.display = 'block';
   document.getElementById('video-section').style.display = 'none';
 }
 
+async function logoutEverywhere() {
+  try {
+    const res = await authFetch('/api/sessions', {
+      method: 'DELETE',
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to log out everywhere: ${data.error}`);
+    }
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+  logout();
+}
+
 function setUploadButtonState(uploading, selector) {
   const uploadBtn = document.getElementById(selector);
   if (uploading) {
@@ -130,11 +215,8 @@ async function uploadThumbnail(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/thumbnail_upload/${videoID}`, {
+    const res = await authFetch(`/api/thumbnail_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -163,11 +245,8 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    const res = await authFetch(`/api/video_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -188,18 +267,26 @@ const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
   try {
-    const res = await fetch('/api/videos', {
-      method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
-    });
-    if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to get videos. Error: ${data.error}`);
-    }
+    const videos = [];
+    let cursor = '';
+    do {
+      const params = new URLSearchParams({ limit: '100' });
+      if (cursor) {
+        params.set('cursor', cursor);
+      }
+      const res = await authFetch(`/api/videos?${params}`, {
+        method: 'GET',
+      });
+      if (!res.ok) {
+        const data = await res.json();
+        throw new Error(`Failed to get videos. Error: ${data.error}`);
+      }
+
+      const page = await res.json();
+      videos.push(...page.videos);
+      cursor = page.next_cursor;
+    } while (cursor);
 
-    const videos = await res.json();
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
     for (const video of videos) {
@@ -211,6 +298,74 @@ async function getVideos() {
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
+
+  await getTrash();
+}
+
+async function getTrash() {
+  try {
+    const res = await authFetch('/api/videos/trash?limit=100', {
+      method: 'GET',
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to get trash. Error: ${data.error}`);
+    }
+
+    const page = await res.json();
+    const trashList = document.getElementById('trash-list');
+    trashList.innerHTML = '';
+    for (const video of page.videos) {
+      const listItem = document.createElement('li');
+      listItem.textContent = video.title;
+
+      const restoreButton = document.createElement('button');
+      restoreButton.textContent = 'Restore';
+      restoreButton.onclick = () => restoreVideo(video.id);
+      listItem.appendChild(restoreButton);
+
+      const deleteButton = document.createElement('button');
+      deleteButton.textContent = 'Delete Forever';
+      deleteButton.onclick = () => deleteVideoForever(video.id);
+      listItem.appendChild(deleteButton);
+
+      trashList.appendChild(listItem);
+    }
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function restoreVideo(videoID) {
+  try {
+    const res = await authFetch(`/api/videos/trash/${videoID}/restore`, {
+      method: 'POST',
+    });
+    if (!res.ok) {
+      throw new Error('Failed to restore video.');
+    }
+    await getVideos();
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function deleteVideoForever(videoID) {
+  if (!confirm('Delete this video and its files for good?')) {
+    return;
+  }
+
+  try {
+    const res = await authFetch(`/api/videos/trash/${videoID}`, {
+      method: 'DELETE',
+    });
+    if (!res.ok) {
+      throw new Error('Failed to delete video.');
+    }
+    await getTrash();
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
 }
 
 function createVideoStateHandler() {
@@ -231,11 +386,8 @@ function createVideoStateHandler() {
 
 async function getVideo(videoID) {
   try {
-    const res = await fetch(`/api/videos/${videoID}`, {
+    const res = await authFetch(`/api/videos/${videoID}`, {
       method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to get video.');
@@ -255,6 +407,7 @@ function viewVideo(video) {
   document.getElementById('video-display').style.display = 'block';
   document.getElementById('video-title-display').textContent = video.title;
   document.getElementById('video-description-display').textContent = video.description;
+  document.getElementById('video-visibility-display').value = video.visibility;
 
   const thumbnailImg = document.getElementById('thumbnail-image');
   if (!video.thumbnail_url) {
@@ -274,6 +427,98 @@ function viewVideo(video) {
       videoPlayer.load();
     }
   }
+
+  loadTags(video.id);
+}
+
+async function loadTags(videoID) {
+  try {
+    const res = await authFetch(`/api/videos/${videoID}/tags`, {
+      method: 'GET',
+    });
+    if (!res.ok) {
+      throw new Error('Failed to get tags.');
+    }
+
+    const tags = await res.json();
+    renderTags(videoID, tags);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+function renderTags(videoID, tags) {
+  const tagList = document.getElementById('tag-list');
+  tagList.innerHTML = '';
+  for (const tag of tags) {
+    const listItem = document.createElement('li');
+    listItem.textContent = tag.name;
+
+    const removeButton = document.createElement('button');
+    removeButton.textContent = '×';
+    removeButton.title = `Remove ${tag.name}`;
+    removeButton.onclick = () => removeTag(videoID, tag.name);
+    listItem.appendChild(removeButton);
+
+    tagList.appendChild(listItem);
+  }
+}
+
+async function addTag(videoID) {
+  if (!videoID) return;
+  const input = document.getElementById('tag-name');
+
+  try {
+    const res = await authFetch(`/api/videos/${videoID}/tags/${encodeURIComponent(input.value)}`, {
+      method: 'PUT',
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to add tag. Error: ${data.error}`);
+    }
+
+    const tags = await res.json();
+    input.value = '';
+    renderTags(videoID, tags);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function removeTag(videoID, name) {
+  try {
+    const res = await authFetch(`/api/videos/${videoID}/tags/${encodeURIComponent(name)}`, {
+      method: 'DELETE',
+    });
+    if (!res.ok) {
+      throw new Error('Failed to remove tag.');
+    }
+
+    await loadTags(videoID);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function updateVisibility(videoID, visibility) {
+  if (!videoID) return;
+
+  try {
+    const res = await authFetch(`/api/videos/${videoID}`, {
+      method: 'PATCH',
+      headers: {
+        'Content-Type': 'application/merge-patch+json',
+      },
+      body: JSON.stringify({ visibility }),
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to update visibility. Error: ${data.error}`);
+    }
+    currentVideo = data;
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
 }
 
 async function deleteVideo() {
@@ -283,16 +528,13 @@ async function deleteVideo() {
   }
 
   try {
-    const res = await fetch(`/api/videos/${currentVideo.id}`, {
+    const res = await authFetch(`/api/videos/${currentVideo.id}`, {
       method: 'DELETE',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to delete video.');
     }
-    alert('Video deleted successfully.');
+    alert('Video moved to trash.');
     document.getElementById('video-display').style.display = 'none';
     await getVideos();
   } catch (error) {
@@ -1,12 +1,17 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -16,30 +21,112 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	return nil
 }
 
-func getAssetPath(mediaType string) string {
-	base := make([]byte, 32)
-	_, err := rand.Read(base)
-	if err != nil {
-		panic("failed to generate random bytes")
-	}
-	id := base64.RawURLEncoding.EncodeToString(base)
-
+// getAssetPath names a file after the SHA-256 of its content, so a name is
+// never reused for different bytes and can be cached forever.
+func getAssetPath(checksum, mediaType string) string {
 	ext := mediaTypeToExt(mediaType)
-	return fmt.Sprintf("%s%s", id, ext)
+	return fmt.Sprintf("%s%s", checksum, ext)
 }
 
-func (cfg apiConfig) getObjectURL(key string) string {
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, key)
+// assetPutOptions describes an uploaded file to the backend. The file's name
+// is derived from its content, so clients and CDNs may cache it forever.
+func assetPutOptions(contentType, checksum string) storage.PutOptions {
+	return storage.PutOptions{
+		ContentType:  contentType,
+		CacheControl: immutableCacheControl,
+		Metadata:     map[string]string{"sha256": checksum},
+	}
 }
 
-func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
-	return filepath.Join(cfg.assetsRoot, assetPath)
+func (cfg apiConfig) getObjectURL(bucket, key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, cfg.s3Region, key)
+}
+
+func (cfg apiConfig) getVideoURL(key string) string {
+	return fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, key)
 }
 
 func (cfg apiConfig) getAssetURL(assetPath string) string {
 	return fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, assetPath)
 }
 
+// Assets record which backend they are stored on by name: "local" for the
+// assets directory, or "s3:<bucket>" for a bucket.
+const localBackend = "local"
+
+func s3Backend(bucket string) string {
+	return "s3:" + bucket
+}
+
+func (cfg *apiConfig) backend(name string) (storage.Backend, error) {
+	if name == localBackend {
+		return cfg.localStore, nil
+	}
+	bucket, ok := strings.CutPrefix(name, "s3:")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+	if bucket == cfg.s3Bucket {
+		return cfg.s3Store, nil
+	}
+	return storage.NewS3(cfg.s3Client, bucket, cfg.s3Encryption)
+}
+
+// backendURL returns the public URL of a key on a backend. Objects in the
+// configured bucket are served through CloudFront.
+func (cfg *apiConfig) backendURL(name, key string) string {
+	if name == localBackend {
+		return cfg.getAssetURL(key)
+	}
+	bucket := strings.TrimPrefix(name, "s3:")
+	if bucket == cfg.s3Bucket {
+		return cfg.getVideoURL(key)
+	}
+	return cfg.getObjectURL(bucket, key)
+}
+
+// parseBackendURL is the inverse of backendURL, for URLs stored before
+// assets were tracked.
+func (cfg *apiConfig) parseBackendURL(url string) (name, key string, ok bool) {
+	if key, ok := strings.CutPrefix(url, cfg.getAssetURL("")); ok {
+		return localBackend, key, true
+	}
+	if key, ok := strings.CutPrefix(url, cfg.getVideoURL("")); ok {
+		return s3Backend(cfg.s3Bucket), key, true
+	}
+	rest, ok := strings.CutPrefix(url, "https://")
+	if !ok {
+		return "", "", false
+	}
+	host, key, ok := strings.Cut(rest, "/")
+	bucket, ok2 := strings.CutSuffix(host, fmt.Sprintf(".s3.%s.amazonaws.com", cfg.s3Region))
+	if !ok || !ok2 {
+		return "", "", false
+	}
+	return s3Backend(bucket), key, true
+}
+
+// assetURL returns the public URL of an asset.
+func (cfg *apiConfig) assetURL(asset database.Asset) string {
+	return cfg.backendURL(asset.Backend, asset.StorageKey)
+}
+
+// hashFile returns the hex encoded SHA-256 of f's contents and rewinds it so
+// it can be read again.
+func hashFile(f io.ReadSeeker) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func mediaTypeToExt(mediaType string) string {
 	parts := strings.Split(mediaType, "/")
 	if len(parts) != 2 {
@@ -47,3 +134,126 @@ func mediaTypeToExt(mediaType string) string {
 	}
 	return "." + parts[1]
 }
+
+// deleteAssetObject removes the stored file backing an asset. Files are named
+// after their content, so the file is kept while other assets still use it.
+func (cfg *apiConfig) deleteAssetObject(ctx context.Context, asset database.Asset) error {
+	shared, err := cfg.db.CountAssetsWithKey(asset.Backend, asset.StorageKey, asset.ID)
+	if err != nil {
+		return err
+	}
+	if shared > 0 {
+		return nil
+	}
+	store, err := cfg.backend(asset.Backend)
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, asset.StorageKey)
+}
+
+// deleteVideoAssets removes stored files and usage records for a video's
+// assets of the given category, skipping the one identified by keep.
+func (cfg *apiConfig) deleteVideoAssets(ctx context.Context, videoID uuid.UUID, category database.AssetCategory, keep uuid.UUID) error {
+	assets, err := cfg.db.GetVideoAssets(videoID)
+	if err != nil {
+		return err
+	}
+	deleted := []database.Asset{}
+	for _, asset := range assets {
+		if asset.ID == keep || (category != "" && asset.Category != category) {
+			continue
+		}
+		if err := cfg.deleteAssetObject(ctx, asset); err != nil {
+			return fmt.Errorf("couldn't delete %s asset %s: %w", asset.Category, asset.ID, err)
+		}
+		if err := cfg.db.DeleteAsset(asset.ID); err != nil {
+			return err
+		}
+		deleted = append(deleted, asset)
+	}
+	return cfg.purgeCDN(ctx, deleted)
+}
+
+// purgeCDN removes assets served through CloudFront from its caches so
+// deleted files stop being served.
+func (cfg *apiConfig) purgeCDN(ctx context.Context, assets []database.Asset) error {
+	keys := []string{}
+	for _, asset := range assets {
+		if asset.Backend == s3Backend(cfg.s3Bucket) {
+			keys = append(keys, asset.StorageKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := cfg.cdn.Purge(ctx, keys); err != nil {
+		return fmt.Errorf("couldn't purge CDN: %w", err)
+	}
+	return nil
+}
+
+// currentThumbnailAsset returns the asset a video's thumbnail is stored as,
+// looked up by its URL. It returns a zero Asset when the video has none.
+func (cfg *apiConfig) currentThumbnailAsset(video database.Video) (database.Asset, error) {
+	if video.ThumbnailURL == nil {
+		return database.Asset{}, nil
+	}
+	backend, key, ok := cfg.parseBackendURL(*video.ThumbnailURL)
+	if !ok {
+		return database.Asset{}, nil
+	}
+	asset, err := cfg.db.GetAssetByKey(backend, key)
+	if err != nil {
+		return database.Asset{}, err
+	}
+	if asset.ID == uuid.Nil {
+		asset = database.Asset{
+			CreateAssetParams: database.CreateAssetParams{
+				UserID:     video.UserID,
+				VideoID:    video.ID,
+				Category:   database.AssetCategoryThumbnail,
+				StorageKey: key,
+				Backend:    backend,
+			},
+		}
+	}
+	return asset, nil
+}
+
+// currentVideoAsset returns the asset a video is currently playing. Videos
+// uploaded before versions were recorded are looked up by their URL. It
+// returns a zero Asset when the video has no file.
+func (cfg *apiConfig) currentVideoAsset(video database.Video) (database.Asset, error) {
+	version, err := cfg.db.GetCurrentVideoVersion(video.ID)
+	if err != nil {
+		return database.Asset{}, err
+	}
+	if version.ID != uuid.Nil {
+		return cfg.db.GetAsset(version.AssetID)
+	}
+
+	if video.VideoURL == nil {
+		return database.Asset{}, nil
+	}
+	backend, key, ok := cfg.parseBackendURL(*video.VideoURL)
+	if !ok {
+		return database.Asset{}, nil
+	}
+	asset, err := cfg.db.GetAssetByKey(backend, key)
+	if err != nil {
+		return database.Asset{}, err
+	}
+	if asset.ID == uuid.Nil {
+		asset = database.Asset{
+			CreateAssetParams: database.CreateAssetParams{
+				UserID:     video.UserID,
+				VideoID:    video.ID,
+				Category:   database.AssetCategoryVideo,
+				StorageKey: key,
+				Backend:    backend,
+			},
+		}
+	}
+	return asset, nil
+}
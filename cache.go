@@ -2,16 +2,17 @@ package main
 
 import "net/http"
 
-// func cacheMiddleware(next http.Handler) http.Handler {
-// 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-// 		w.Header().Set("Cache-Control", "max-age=3600")
-// 		next.ServeHTTP(w, r)
-// 	})
-// }
+// immutableCacheControl is sent with stored assets. Their names are derived
+// from their content, so a name always refers to the same bytes.
+const immutableCacheControl = "public, max-age=31536000, immutable"
 
-func noCacheMiddleware(next http.Handler) http.Handler {
+// privateImmutableCacheControl is sent instead for assets that aren't public,
+// so only the browser that was allowed to fetch them keeps a copy.
+const privateImmutableCacheControl = "private, max-age=31536000, immutable"
+
+func cacheMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Cache-Control", immutableCacheControl)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// newStorageTestConfig returns a config whose bucket is served through a CDN that
+// records what it is asked to purge, with a video owned by a new user. The
+// bucket and the assets directory are both local directories.
+func newStorageTestConfig(t *testing.T) (*apiConfig, *cdn.Recorder, database.Video) {
+	t.Helper()
+	db := newTestDB(t)
+	recorder := &cdn.Recorder{}
+	cfg := &apiConfig{
+		db:                    db,
+		cdn:                   recorder,
+		localStore:            storage.NewLocal(t.TempDir(), nil),
+		s3Store:               storage.NewLocal(t.TempDir(), nil),
+		s3Bucket:              "tubely",
+		videoVersionRetention: 1,
+	}
+	user, err := db.CreateUser(database.CreateUserParams{Email: "a@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	video, err := db.CreateVideo(database.CreateVideoParams{UserID: user.ID, Title: "cats", Visibility: database.VideoPublic})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	return cfg, recorder, video
+}
+
+// createTestAsset stores a one byte file at key on a backend and records it
+// as an asset of the video.
+func createTestAsset(t *testing.T, cfg *apiConfig, video database.Video, category database.AssetCategory, backend, key string) database.Asset {
+	t.Helper()
+	store, err := cfg.backend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), key, strings.NewReader("x"), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	asset, err := cfg.db.CreateAsset(database.CreateAssetParams{
+		UserID:     video.UserID,
+		VideoID:    video.ID,
+		Category:   category,
+		StorageKey: key,
+		Size:       1,
+		Backend:    backend,
+	})
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	return asset
+}
+
+// setTestVideoVisibility changes the visibility of the stored video, without
+// moving its files.
+func setTestVideoVisibility(t *testing.T, cfg *apiConfig, id uuid.UUID, visibility database.VideoVisibility) {
+	t.Helper()
+	video, err := cfg.db.GetVideo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	video.Visibility = visibility
+	if err := cfg.db.UpdateVideoIfUnchanged(video); err != nil {
+		t.Fatalf("UpdateVideoIfUnchanged: %v", err)
+	}
+}
+
+func assertPurged(t *testing.T, recorder *cdn.Recorder, want ...string) {
+	t.Helper()
+	got := recorder.Keys()
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("purged %q, want %q", got, want)
+	}
+}
+
+func TestCDNPurgeOnReplace(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, s3Backend(cfg.s3Bucket), "old.png")
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	replacement := createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, s3Backend(cfg.s3Bucket), "new.png")
+
+	if err := cfg.deleteVideoAssets(context.Background(), video.ID, database.AssetCategoryThumbnail, replacement.ID); err != nil {
+		t.Fatalf("deleteVideoAssets: %v", err)
+	}
+	assertPurged(t, recorder, "old.png")
+}
+
+func TestCDNPurgeOnDelete(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, s3Backend(cfg.s3Bucket), "thumb.png")
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	// Files in the assets directory aren't served through the CDN.
+	createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, localBackend, "local.png")
+
+	if err := cfg.purgeVideo(context.Background(), video); err != nil {
+		t.Fatalf("purgeVideo: %v", err)
+	}
+	assertPurged(t, recorder, "thumb.png", "video.mp4")
+}
+
+func TestCDNPurgeOnVersionPrune(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	for _, key := range []string{"v1.mp4", "v2.mp4"} {
+		asset := createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), key)
+		_, err := cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{VideoID: video.ID, AssetID: asset.ID, UploadedBy: video.UserID})
+		if err != nil {
+			t.Fatalf("CreateVideoVersion: %v", err)
+		}
+	}
+
+	if err := cfg.pruneVideoVersions(context.Background(), video.ID); err != nil {
+		t.Fatalf("pruneVideoVersions: %v", err)
+	}
+	assertPurged(t, recorder, "v1.mp4")
+}
+
+func TestCDNPurgeOnTakedown(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, s3Backend(cfg.s3Bucket), "thumb.png")
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	publishedURL := cfg.backendURL(s3Backend(cfg.s3Bucket), "video.mp4")
+	if err := cfg.db.SetVideoURL(video.ID, publishedURL); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/videos/"+video.ID.String()+"/takedown", strings.NewReader(`{"reason": "spam"}`))
+	r.SetPathValue("videoID", video.ID.String())
+	w := httptest.NewRecorder()
+	cfg.handlerAdminVideoTakeDown(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("takedown = %d: %s", w.Code, w.Body)
+	}
+	assertPurged(t, recorder, "thumb.png", "video.mp4")
+	assertHidden(t, cfg, video.ID, publishedURL, "thumb.png", "video.mp4")
+}
+
+// assertHidden checks that the files a video had at the published keys were
+// moved away, so their old CDN URLs don't resolve once the cache is purged,
+// and that the video now points at the moved copies.
+func assertHidden(t *testing.T, cfg *apiConfig, videoID uuid.UUID, publishedURL string, publishedKeys ...string) {
+	t.Helper()
+	for _, key := range publishedKeys {
+		if _, err := cfg.s3Store.Head(context.Background(), key); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s is still in the bucket: %v", key, err)
+		}
+	}
+	assets, err := cfg.db.GetVideoAssets(videoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, asset := range assets {
+		if !isHiddenKey(asset.StorageKey) {
+			t.Errorf("asset is at %s, want it hidden", asset.StorageKey)
+		}
+		if _, err := cfg.s3Store.Head(context.Background(), asset.StorageKey); err != nil {
+			t.Errorf("hidden copy %s: %v", asset.StorageKey, err)
+		}
+	}
+	video, err := cfg.db.GetTrashedVideo(videoID)
+	if err == nil && video.ID == uuid.Nil {
+		video, err = cfg.db.GetVideo(videoID)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.VideoURL == nil || *video.VideoURL == publishedURL {
+		t.Errorf("video URL is still %v", video.VideoURL)
+	}
+}
+
+func TestSyncVideoMediaPublishesAgain(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	// Another public video with the same content keeps its copy.
+	other, err := cfg.db.CreateVideo(database.CreateVideoParams{UserID: video.UserID, Title: "dogs", Visibility: database.VideoPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestAsset(t, cfg, other, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	publishedURL := cfg.backendURL(s3Backend(cfg.s3Bucket), "video.mp4")
+	for _, id := range []uuid.UUID{video.ID, other.ID} {
+		if err := cfg.db.SetVideoURL(id, publishedURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setVisibility := func(visibility database.VideoVisibility) {
+		t.Helper()
+		setTestVideoVisibility(t, cfg, video.ID, visibility)
+		if err := cfg.syncVideoMedia(context.Background(), video.ID); err != nil {
+			t.Fatalf("syncVideoMedia: %v", err)
+		}
+	}
+
+	setVisibility(database.VideoPrivate)
+	if _, err := cfg.s3Store.Head(context.Background(), "video.mp4"); err != nil {
+		t.Errorf("the other video's file was deleted: %v", err)
+	}
+	if got, _ := cfg.db.GetVideo(other.ID); got.VideoURL == nil || *got.VideoURL != publishedURL {
+		t.Errorf("the other video's URL changed to %v", got.VideoURL)
+	}
+	hidden, _ := cfg.db.GetVideo(video.ID)
+	if hidden.VideoURL == nil || *hidden.VideoURL == publishedURL {
+		t.Errorf("video URL is still %v", hidden.VideoURL)
+	}
+
+	setVisibility(database.VideoPublic)
+	published, _ := cfg.db.GetVideo(video.ID)
+	if published.VideoURL == nil || *published.VideoURL != publishedURL {
+		t.Errorf("video URL after publishing again = %v, want %s", published.VideoURL, publishedURL)
+	}
+	assets, _ := cfg.db.GetVideoAssets(video.ID)
+	if len(assets) != 1 || assets[0].StorageKey != "video.mp4" {
+		t.Errorf("assets after publishing again = %+v", assets)
+	}
+	if _, err := cfg.s3Store.Head(context.Background(), "video.mp4"); err != nil {
+		t.Errorf("published file: %v", err)
+	}
+	assertPurged(t, recorder, "video.mp4")
+}
+
+func TestTrashHidesMedia(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	publishedURL := cfg.backendURL(s3Backend(cfg.s3Bucket), "video.mp4")
+	if err := cfg.db.SetVideoURL(video.ID, publishedURL); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/videos/"+video.ID.String(), nil)
+	r.SetPathValue("videoID", video.ID.String())
+	w := httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(w, asUser(r, video.UserID))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d: %s", w.Code, w.Body)
+	}
+	assertPurged(t, recorder, "video.mp4")
+	assertHidden(t, cfg, video.ID, publishedURL, "video.mp4")
+
+	r = httptest.NewRequest(http.MethodPost, "/api/trash/"+video.ID.String()+"/restore", nil)
+	r.SetPathValue("videoID", video.ID.String())
+	w = httptest.NewRecorder()
+	cfg.handlerTrashRestore(w, asUser(r, video.UserID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore = %d: %s", w.Code, w.Body)
+	}
+	if got, _ := cfg.db.GetVideo(video.ID); got.VideoURL == nil || *got.VideoURL != publishedURL {
+		t.Errorf("video URL after restoring = %v, want %s", got.VideoURL, publishedURL)
+	}
+	if _, err := cfg.s3Store.Head(context.Background(), "video.mp4"); err != nil {
+		t.Errorf("restored file: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// commandMigrate applies, rolls back or lists schema migrations. It runs
+// before the rest of the configuration is loaded, since it only needs the
+// database.
+//
+//	migrate [up]
+//	migrate down [-steps n]
+//	migrate status
+func commandMigrate(db database.Client, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "up":
+		if err := db.Migrate(); err != nil {
+			return err
+		}
+		log.Printf("Database is up to date")
+		return nil
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		flags.Parse(args)
+		rolledBack, err := db.RollbackMigrations(*steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rolled back %d migrations", rolledBack)
+		return nil
+	case "status":
+		statuses, err := db.GetMigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-40s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+	}
+}
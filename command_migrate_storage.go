@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// commandMigrateStorage copies every asset on one backend to another and
+// points the database at the copies. Each batch is only recorded once all of
+// its copies have been verified, so an interrupted run can simply be started
+// again and picks up the assets that are still on the source backend.
+func (cfg *apiConfig) commandMigrateStorage(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	from := flags.String("from", "", "backend to copy assets from, e.g. local or s3:<bucket>")
+	to := flags.String("to", "", "backend to copy assets to")
+	dryRun := flags.Bool("dry-run", false, "report what would be copied without changing anything")
+	batchSize := flags.Int("batch", commandBatchSize, "number of assets copied between database updates")
+	deleteSource := flags.Bool("delete-source", false, "delete objects from the source once the database points at the copies")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *from == *to {
+		return errors.New("-from and -to must name two different backends")
+	}
+	if *batchSize <= 0 {
+		return errors.New("-batch must be positive")
+	}
+
+	src, err := cfg.backend(*from)
+	if err != nil {
+		return err
+	}
+	dst, err := cfg.backend(*to)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.trackReferencedAssets(ctx, *from, src, *dryRun); err != nil {
+		return err
+	}
+
+	copied, bytesCopied := 0, int64(0)
+	after := uuid.Nil
+	for {
+		assets, err := cfg.db.GetAssetsOnBackend(*from, after, *batchSize)
+		if err != nil {
+			return err
+		}
+		if len(assets) == 0 {
+			break
+		}
+		after = assets[len(assets)-1].ID
+
+		if *dryRun {
+			for _, asset := range assets {
+				log.Printf("Would copy %s (%d bytes)", asset.StorageKey, asset.Size)
+				copied++
+				bytesCopied += asset.Size
+			}
+			continue
+		}
+
+		moves := make([]database.AssetMove, 0, len(assets))
+		for _, asset := range assets {
+			checksum, err := copyObject(ctx, src, dst, asset, asset.StorageKey)
+			if err != nil {
+				return fmt.Errorf("couldn't copy %s: %w", asset.StorageKey, err)
+			}
+			moves = append(moves, database.AssetMove{
+				AssetID:    asset.ID,
+				Backend:    *to,
+				StorageKey: asset.StorageKey,
+				Checksum:   checksum,
+				OldURL:     cfg.assetURL(asset),
+				NewURL:     cfg.backendURL(*to, asset.StorageKey),
+			})
+			copied++
+			bytesCopied += asset.Size
+		}
+		if err := cfg.db.MoveAssets(moves); err != nil {
+			return fmt.Errorf("couldn't update database: %w", err)
+		}
+		log.Printf("Copied %d assets (%d bytes) so far", copied, bytesCopied)
+
+		if *deleteSource {
+			for _, asset := range assets {
+				// Assets with the same content share a file, and the
+				// others may not have been copied yet.
+				remaining, err := cfg.db.CountAssetsWithKey(*from, asset.StorageKey, uuid.Nil)
+				if err != nil {
+					return err
+				}
+				if remaining > 0 {
+					continue
+				}
+				if err := src.Delete(ctx, asset.StorageKey); err != nil {
+					log.Printf("Couldn't delete %s from %s: %v", asset.StorageKey, *from, err)
+				}
+			}
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: would copy %d assets (%d bytes) from %s to %s", copied, bytesCopied, *from, *to)
+		return nil
+	}
+	log.Printf("Copied %d assets (%d bytes) from %s to %s", copied, bytesCopied, *from, *to)
+	return nil
+}
+
+// trackReferencedAssets records assets for files that videos reference on a
+// backend but that were uploaded before assets were tracked, so they are
+// migrated too.
+func (cfg *apiConfig) trackReferencedAssets(ctx context.Context, name string, store storage.Backend, dryRun bool) error {
+	after := uuid.Nil
+	for {
+		videos, err := cfg.db.GetVideosPage(after, commandBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(videos) == 0 {
+			return nil
+		}
+		after = videos[len(videos)-1].ID
+
+		for _, video := range videos {
+			refs := map[database.AssetCategory]*string{
+				database.AssetCategoryThumbnail: video.ThumbnailURL,
+				database.AssetCategoryVideo:     video.VideoURL,
+			}
+			for category, url := range refs {
+				if url == nil {
+					continue
+				}
+				backend, key, ok := cfg.parseBackendURL(*url)
+				if !ok || backend != name {
+					continue
+				}
+				asset, err := cfg.db.GetAssetByKey(backend, key)
+				if err != nil {
+					return err
+				}
+				if asset.ID != uuid.Nil {
+					continue
+				}
+
+				obj, err := store.Head(ctx, key)
+				if errors.Is(err, storage.ErrNotFound) {
+					log.Printf("Video %s references missing object %s, skipping", video.ID, key)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if dryRun {
+					log.Printf("Would start tracking %s for video %s", key, video.ID)
+					continue
+				}
+				_, err = cfg.db.CreateAsset(database.CreateAssetParams{
+					UserID:     video.UserID,
+					VideoID:    video.ID,
+					Category:   category,
+					StorageKey: key,
+					Size:       obj.Size,
+					Backend:    backend,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// copyObject copies an asset to dstKey on another backend, or the same one,
+// through a temporary file and reads the copy back to check it matches the
+// original byte for byte. The original is checked against the asset's
+// recorded checksum when it has one. It returns the checksum of the copied
+// content.
+func copyObject(ctx context.Context, src, dst storage.Backend, asset database.Asset, dstKey string) (string, error) {
+	tmp, err := os.CreateTemp("", "tubely-migrate")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	body, obj, err := src.Get(ctx, asset.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	srcHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, srcHash), body)
+	body.Close()
+	if err != nil {
+		return "", err
+	}
+	if size != asset.Size {
+		return "", fmt.Errorf("source has %d bytes, expected %d", size, asset.Size)
+	}
+	checksum := hex.EncodeToString(srcHash.Sum(nil))
+	if asset.Checksum != "" && checksum != asset.Checksum {
+		return "", fmt.Errorf("source checksum %s doesn't match recorded %s", checksum, asset.Checksum)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	opts := assetPutOptions(obj.ContentType, checksum)
+	if isHiddenKey(dstKey) {
+		opts.CacheControl = privateImmutableCacheControl
+	}
+	err = dst.Put(ctx, dstKey, tmp, opts)
+	if err != nil {
+		return "", err
+	}
+
+	dstChecksum, err := hashObject(ctx, dst, dstKey)
+	if err != nil {
+		return "", fmt.Errorf("couldn't verify copy: %w", err)
+	}
+	if dstChecksum != checksum {
+		return "", fmt.Errorf("checksum mismatch: source %s, copy %s", checksum, dstChecksum)
+	}
+	return checksum, nil
+}
+
+// hashObject returns the hex encoded SHA-256 of a stored object.
+func hashObject(ctx context.Context, store storage.Backend, key string) (string, error) {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+const commandBatchSize = 100
+
+// runCommand runs one of the maintenance subcommands instead of the server.
+func (cfg *apiConfig) runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "rotate-keys":
+		return cfg.commandRotateKeys(ctx)
+	case "migrate-storage":
+		return cfg.commandMigrateStorage(ctx, args[1:])
+	case "scrub":
+		return cfg.commandScrub(ctx, args[1:])
+	case "purge-trash":
+		return cfg.commandPurgeTrash(ctx)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// commandRotateKeys re-encrypts every stored asset with the current keys, so
+// old keys can be dropped from the configuration afterwards.
+func (cfg *apiConfig) commandRotateKeys(ctx context.Context) error {
+	rotated := 0
+	after := uuid.Nil
+	for {
+		assets, err := cfg.db.GetAssetsPage(after, commandBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(assets) == 0 {
+			break
+		}
+		for _, asset := range assets {
+			store, err := cfg.backend(asset.Backend)
+			if err != nil {
+				return err
+			}
+			err = store.Rotate(ctx, asset.StorageKey)
+			if err != nil {
+				return fmt.Errorf("couldn't rotate %s: %w", asset.StorageKey, err)
+			}
+			rotated++
+		}
+		after = assets[len(assets)-1].ID
+	}
+	log.Printf("Rotated keys for %d assets", rotated)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// loadS3Encryption reads the server-side encryption settings applied to every
+// object the app writes to S3.
+func loadS3Encryption() (storage.S3Encryption, error) {
+	enc := storage.S3Encryption{
+		Mode:     storage.SSEMode(os.Getenv("S3_SSE")),
+		KMSKeyID: os.Getenv("S3_SSE_KMS_KEY_ID"),
+	}
+	if enc.Mode != storage.SSEC {
+		return enc, enc.Validate()
+	}
+
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("S3_SSE_C_KEY"))
+	if err != nil {
+		return storage.S3Encryption{}, fmt.Errorf("couldn't decode S3_SSE_C_KEY: %w", err)
+	}
+	enc.CustomerKey = key
+
+	if previous := os.Getenv("S3_SSE_C_PREVIOUS_KEY"); previous != "" {
+		enc.PreviousCustomerKey, err = base64.StdEncoding.DecodeString(previous)
+		if err != nil {
+			return storage.S3Encryption{}, fmt.Errorf("couldn't decode S3_SSE_C_PREVIOUS_KEY: %w", err)
+		}
+	}
+	return enc, enc.Validate()
+}
+
+// loadLocalKeyRing reads the keys used to encrypt files in the assets
+// directory. It returns nil when local encryption is disabled.
+func loadLocalKeyRing() (*storage.KeyRing, error) {
+	spec := os.Getenv("LOCAL_ENCRYPTION_KEYS")
+	if spec == "" {
+		return nil, nil
+	}
+	return storage.ParseKeyRing(spec)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxTakedownReasonLength = 500
+
+func (cfg *apiConfig) handlerAdminUsersList(w http.ResponseWriter, r *http.Request) {
+	users, err := cfg.db.GetUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get users", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// handlerAdminUserRoleUpdate changes a user's role. Admins can't change their
+// own, so there is always at least one admin left.
+func (cfg *apiConfig) handlerAdminUserRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role database.Role `json:"role"`
+	}
+
+	user, ok := cfg.loadOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Role.Valid() {
+		respondWithError(w, http.StatusBadRequest, "role must be user, moderator or admin", nil)
+		return
+	}
+
+	if err := cfg.db.SetUserRole(user.ID, params.Role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+	cfg.respondWithUser(w, user.ID)
+}
+
+// handlerAdminUserDisable disables an account and ends its sessions. Its API
+// keys are kept, but are rejected while the account is disabled.
+func (cfg *apiConfig) handlerAdminUserDisable(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.SetUserDisabled(user.ID, true); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable user", err)
+		return
+	}
+	if err := cfg.db.RevokeUserSessions(user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	cfg.respondWithUser(w, user.ID)
+}
+
+func (cfg *apiConfig) handlerAdminUserEnable(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.loadOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.SetUserDisabled(user.ID, false); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable user", err)
+		return
+	}
+	cfg.respondWithUser(w, user.ID)
+}
+
+// loadOtherUser gets the user named by the request's userID path value.
+// Admins manage other users through it, never themselves, so they can't lock
+// themselves out.
+func (cfg *apiConfig) loadOtherUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return nil, false
+	}
+	if userID == requestUserID(r) {
+		respondWithError(w, http.StatusForbidden, "Admins can't change their own account", nil)
+		return nil, false
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return nil, false
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return nil, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) respondWithUser(w http.ResponseWriter, userID uuid.UUID) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// handlerAdminVideoTakeDown hides a video from everyone but its owner, who
+// sees the reason and can't make it visible again until it is reinstated.
+// Its files are moved out of the CDN's reach and purged from its caches, and
+// from then on are only served through signed URLs.
+func (cfg *apiConfig) handlerAdminVideoTakeDown(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	video, ok := cfg.loadAnyVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" || utf8.RuneCountInString(params.Reason) > maxTakedownReasonLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("reason must be between 1 and %d characters", maxTakedownReasonLength), nil)
+		return
+	}
+
+	if err := cfg.db.TakeDownVideo(video.ID, params.Reason); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't take down video", err)
+		return
+	}
+	// Taking a video down again is harmless, so a failed move can be retried.
+	if err := cfg.syncVideoMedia(r.Context(), video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hide video files", err)
+		return
+	}
+	cfg.respondWithVideo(w, video.ID)
+}
+
+func (cfg *apiConfig) handlerAdminVideoReinstate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadAnyVideo(w, r)
+	if !ok {
+		return
+	}
+	if video.TakenDownAt == nil {
+		respondWithError(w, http.StatusNotFound, "Video isn't taken down", nil)
+		return
+	}
+
+	if err := cfg.db.ReinstateVideo(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reinstate video", err)
+		return
+	}
+	cfg.respondWithVideo(w, video.ID)
+}
+
+// loadAnyVideo gets the video named by the request's videoID path value,
+// whoever owns it and whatever its visibility.
+func (cfg *apiConfig) loadAnyVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+func (cfg *apiConfig) respondWithVideo(w http.ResponseWriter, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (cfg *apiConfig) handlerAssetHealthReport(w http.ResponseWriter, r *http.Request) {
+	report, err := cfg.db.GetAssetHealthReport()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get asset health report", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
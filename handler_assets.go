@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerAssetGet serves files from the local assets directory. They are read
+// through the storage backend rather than straight off disk because they may
+// be encrypted at rest. Files that belong to videos are only served to users
+// who can see one of those videos.
+func (cfg *apiConfig) handlerAssetGet(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	videos, err := cfg.db.GetVideosWithAsset(localBackend, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up asset", err)
+		return
+	}
+	if len(videos) > 0 {
+		userID := requestUserID(r)
+		visible, public := false, false
+		for _, video := range videos {
+			visible = visible || canViewVideo(video, userID)
+			public = public || (canViewVideo(video, uuid.Nil) && video.Visibility == database.VideoPublic)
+		}
+		if !visible {
+			respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+			return
+		}
+		if !public {
+			w.Header().Set("Cache-Control", privateImmutableCacheControl)
+		}
+	}
+
+	obj, err := cfg.localStore.Head(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Asset not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read asset", err)
+		return
+	}
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	if obj.ETag != "" {
+		w.Header().Set("ETag", obj.ETag)
+	}
+
+	content := storage.NewReadSeeker(r.Context(), cfg.localStore, key, obj.Size)
+	defer content.Close()
+	http.ServeContent(w, r, path.Base(key), obj.LastModified, content)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// handlerJWKS publishes the public keys access tokens can be verified with.
+// Keys stay listed while they are in the key set, so services caching this
+// can still verify tokens signed before a rotation.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Keys: cfg.jwtKeys.JWKS(),
+	})
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// handlerRefresh trades a refresh token for a new access token and a new
+// refresh token. Each refresh token works once: presenting one that was
+// already rotated means it leaked, so every token descended from the same
+// login is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,27 +26,87 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	stored, err := cfg.db.GetRefreshToken(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		return
+	}
+	if stored.Token == "" {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token", nil)
+		return
+	}
+	if stored.ReplacedBy != nil {
+		cfg.revokeReusedRefreshToken(stored)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used", nil)
+		return
+	}
+	if stored.RevokedAt != nil {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was revoked", nil)
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token expired", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(stored.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account is disabled", nil)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-	)
+	// The access token is made before the refresh token is rotated, so a
+	// failure here leaves the client's refresh token usable for a retry.
+	accessToken, err := cfg.makeAccessToken(user.ID, stored.FamilyID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access token", err)
+		return
+	}
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	_, err = cfg.db.RotateRefreshToken(refreshToken, database.CreateRefreshTokenParams{
+		Token:     newRefreshToken,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(cfg.refreshTokenTTL),
+		FamilyID:  stored.FamilyID,
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+	})
+	if errors.Is(err, database.ErrRefreshTokenUsed) {
+		// Another request rotated the token since it was read.
+		cfg.revokeReusedRefreshToken(stored)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
+func (cfg *apiConfig) revokeReusedRefreshToken(token database.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %s, revoking its login", token.UserID)
+	if err := cfg.db.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+		log.Printf("Couldn't revoke refresh tokens for user %s: %v", token.UserID, err)
+	}
+}
+
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestDB returns a freshly migrated SQLite database.
+func newTestDB(t *testing.T) database.Client {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if errors.Is(err, database.ErrNoFTS5) {
+		t.Fatal("SQLite needs FTS5, run the tests with -tags sqlite_fts5 or make test")
+	}
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+// newRefreshTestConfig returns a config backed by a freshly migrated SQLite
+// database, with a user who has logged in once.
+func newRefreshTestConfig(t *testing.T) (*apiConfig, database.User, database.RefreshToken) {
+	t.Helper()
+	db := newTestDB(t)
+	cfg := &apiConfig{
+		db:              db,
+		jwtKeys:         auth.NewHMACKeySet("test secret"),
+		accessTokenTTL:  time.Minute,
+		refreshTokenTTL: time.Hour,
+	}
+
+	user, err := db.CreateUser(database.CreateUserParams{Email: "a@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	login := createTestRefreshToken(t, cfg, user.ID, time.Now().Add(time.Hour))
+	return cfg, *user, login
+}
+
+func createTestRefreshToken(t *testing.T, cfg *apiConfig, userID uuid.UUID, expiresAt time.Time) database.RefreshToken {
+	t.Helper()
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{Token: token, UserID: userID, ExpiresAt: expiresAt.UTC()})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	return rt
+}
+
+func refresh(cfg *apiConfig, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.handlerRefresh(w, r)
+	return w
+}
+
+// userlessStore loses every user, as if they were deleted between reading
+// the token and its user.
+type userlessStore struct {
+	database.Store
+}
+
+func (userlessStore) GetUser(uuid.UUID) (*database.User, error) {
+	return nil, nil
+}
+
+func TestHandlerRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup returns the token to present.
+		setup         func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string
+		wantStatus    int
+		familyRevoked bool
+	}{
+		{
+			name: "valid",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				return login.Token
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "unknown",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				return login.Token[:8] + "unknown"
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				return createTestRefreshToken(t, cfg, user.ID, time.Now().Add(-time.Minute)).Token
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				if err := cfg.db.RevokeRefreshToken(login.Token); err != nil {
+					t.Fatal(err)
+				}
+				return login.Token
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "rotated",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				if w := refresh(cfg, login.Token); w.Code != http.StatusOK {
+					t.Fatalf("first refresh = %d %s", w.Code, w.Body)
+				}
+				return login.Token
+			},
+			wantStatus:    http.StatusUnauthorized,
+			familyRevoked: true,
+		},
+		{
+			name: "missing user",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				cfg.db = userlessStore{cfg.db}
+				return login.Token
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "disabled user",
+			setup: func(t *testing.T, cfg *apiConfig, user database.User, login database.RefreshToken) string {
+				if err := cfg.db.SetUserDisabled(user.ID, true); err != nil {
+					t.Fatal(err)
+				}
+				return login.Token
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, user, login := newRefreshTestConfig(t)
+			token := tt.setup(t, cfg, user, login)
+
+			w := refresh(cfg, token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+
+			active, err := cfg.db.IsSessionActive(user.ID, login.FamilyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.familyRevoked && active {
+				t.Error("the login is still active after its token was reused")
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if !active {
+				t.Error("the login ended after a refresh")
+			}
+
+			var body struct {
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cfg.authenticateAccessToken(body.Token); err != nil {
+				t.Errorf("new access token doesn't work: %v", err)
+			}
+			next, _ := cfg.db.GetRefreshToken(body.RefreshToken)
+			if next.Token == "" || next.RevokedAt != nil || next.FamilyID != login.FamilyID {
+				t.Errorf("new refresh token = %+v, want a valid token of the same login", next)
+			}
+			old, _ := cfg.db.GetRefreshToken(login.Token)
+			if old.RevokedAt == nil || old.ReplacedBy == nil {
+				t.Errorf("old refresh token = %+v, want it revoked and replaced", old)
+			}
+		})
+	}
+}
+
+func TestHandlerRefreshConcurrently(t *testing.T) {
+	cfg, user, login := newRefreshTestConfig(t)
+
+	const requests = 8
+	var wg sync.WaitGroup
+	codes := make(chan int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- refresh(cfg, login.Token).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	ok := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusUnauthorized:
+		default:
+			t.Errorf("status = %d", code)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d requests refreshed the token, want 1", ok)
+	}
+	// The losers presented a token that was already rotated, which looks like
+	// reuse, so the whole login is revoked.
+	if active, _ := cfg.db.IsSessionActive(user.ID, login.FamilyID); active {
+		t.Error("the login is still active after its token was used twice")
+	}
+}
@@ -1,32 +1,16 @@
 package main
 
 import (
-	"io"
+	"log"
 	"mime"
 	"net/http"
-	"os"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
 		return
 	}
 
@@ -50,37 +34,66 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	assetPath := getAssetPath(mediaType)
-	assetDiskPath := cfg.getAssetDiskPath(assetPath)
+	if !cfg.enforceStorageQuota(w, video.UserID, header.Size) {
+		return
+	}
 
-	dst, err := os.Create(assetDiskPath)
+	checksum, err := hashFile(file)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create file on server", err)
+		respondWithError(w, http.StatusInternalServerError, "Error reading file", err)
 		return
 	}
-	defer dst.Close()
-	if _, err = io.Copy(dst, file); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error saving file", err)
+
+	assetPath := getAssetPath(checksum, mediaType)
+
+	store, err := cfg.backend(cfg.thumbnailBackend)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open storage", err)
 		return
 	}
-
-	video, err := cfg.db.GetVideo(videoID)
+	err = store.Put(r.Context(), assetPath, file, assetPutOptions(mediaType, checksum))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		respondWithError(w, http.StatusInternalServerError, "Error saving file", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
+
+	asset, ok := cfg.createAssetWithinQuota(r.Context(), w, database.CreateAssetParams{
+		UserID:     video.UserID,
+		VideoID:    video.ID,
+		Category:   database.AssetCategoryThumbnail,
+		StorageKey: assetPath,
+		Size:       header.Size,
+		Backend:    cfg.thumbnailBackend,
+		Checksum:   checksum,
+
+		OriginalFilename: header.Filename,
+		ContentType:      mediaType,
+	})
+	if !ok {
 		return
 	}
 
-	url := cfg.getAssetURL(assetPath)
-	video.ThumbnailURL = &url
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.db.SetVideoThumbnailURL(video.ID, cfg.assetURL(asset))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
+	// New files are stored at their published keys, which is only where
+	// they belong if the video is public.
+	err = cfg.syncVideoMedia(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video files", err)
+		return
+	}
+	video, ok = cfg.reloadVideo(w, video.ID)
+	if !ok {
+		return
+	}
+
+	err = cfg.deleteVideoAssets(r.Context(), video.ID, database.AssetCategoryThumbnail, asset.ID)
+	if err != nil {
+		log.Printf("Couldn't clean up old thumbnails for video %s: %v", video.ID, err)
+	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
 }
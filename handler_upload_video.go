@@ -6,48 +6,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	const uploadLimit = 1 << 30
 	r.Body = http.MaxBytesReader(w, r.Body, uploadLimit)
 
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
-		return
-	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
+	if !cfg.enforceStorageQuota(w, video.UserID, r.ContentLength) {
 		return
 	}
 
@@ -68,6 +47,10 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !cfg.enforceStorageQuota(w, video.UserID, handler.Size) {
+		return
+	}
+
 	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Could not create temp file", err)
@@ -88,12 +71,12 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 
 	directory := ""
-	aspectRatio, err := getVideoAspectRatio(tempFile.Name())
+	mediaInfo, err := getVideoMediaInfo(tempFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error determining aspect ratio", err)
 		return
 	}
-	switch aspectRatio {
+	switch mediaInfo.AspectRatio {
 	case "16:9":
 		directory = "landscape"
 	case "9:16":
@@ -102,9 +85,6 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		directory = "other"
 	}
 
-	key := getAssetPath(mediaType)
-	key = filepath.Join(directory, key)
-
 	processedFilePath, err := processVideoForFastStart(tempFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error processing video", err)
@@ -119,30 +99,97 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	defer processedFile.Close()
 
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(key),
-		Body:        processedFile,
-		ContentType: aws.String(mediaType),
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not stat processed file", err)
+		return
+	}
+
+	checksum, err := hashFile(processedFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not hash processed file", err)
+		return
+	}
+
+	key := getAssetPath(checksum, mediaType)
+	key = filepath.Join(directory, key)
+
+	store, err := cfg.backend(cfg.videoBackend)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open storage", err)
+		return
+	}
+	err = store.Put(r.Context(), key, processedFile, assetPutOptions(mediaType, checksum))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error uploading file", err)
+		return
+	}
+
+	asset, ok := cfg.createAssetWithinQuota(r.Context(), w, database.CreateAssetParams{
+		UserID:     video.UserID,
+		VideoID:    video.ID,
+		Category:   database.AssetCategoryVideo,
+		StorageKey: key,
+		Size:       processedInfo.Size(),
+		Backend:    cfg.videoBackend,
+		Checksum:   checksum,
+
+		OriginalFilename: handler.Filename,
+		ContentType:      mediaType,
+	})
+	if !ok {
+		return
+	}
+
+	_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{
+		VideoID:         video.ID,
+		AssetID:         asset.ID,
+		SHA256:          checksum,
+		Width:           mediaInfo.Width,
+		Height:          mediaInfo.Height,
+		DurationSeconds: mediaInfo.DurationSeconds,
+		AspectRatio:     mediaInfo.AspectRatio,
+		UploadedBy:      video.UserID,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error uploading file to S3", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record video version", err)
 		return
 	}
 
 	// Almacenar la URL completa de CloudFront en lugar de bucket y key separados por comas
-	url := fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, key)
-	video.VideoURL = &url
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.db.SetVideoURL(video.ID, cfg.assetURL(asset))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
+	// New files are stored at their published keys, which is only where
+	// they belong if the video is public.
+	err = cfg.syncVideoMedia(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video files", err)
+		return
+	}
+	video, ok = cfg.reloadVideo(w, video.ID)
+	if !ok {
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	err = cfg.pruneVideoVersions(r.Context(), video.ID)
+	if err != nil {
+		log.Printf("Couldn't prune old versions of video %s: %v", video.ID, err)
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
+type videoMediaInfo struct {
+	Width           int
+	Height          int
+	DurationSeconds float64
+	AspectRatio     string
+}
+
+func getVideoMediaInfo(filePath string) (videoMediaInfo, error) {
 	cmd := exec.Command("ffprobe",
 		"-v", "error",
 		"-print_format", "json",
@@ -154,32 +201,51 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	cmd.Stdout = &stdout
 
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffprobe error: %v", err)
+		return videoMediaInfo{}, fmt.Errorf("ffprobe error: %v", err)
 	}
 
 	var output struct {
 		Streams []struct {
-			Width  int `json:"width"`
-			Height int `json:"height"`
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Duration  string `json:"duration"`
 		} `json:"streams"`
 	}
 	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
-		return "", fmt.Errorf("could not parse ffprobe output: %v", err)
+		return videoMediaInfo{}, fmt.Errorf("could not parse ffprobe output: %v", err)
 	}
 
 	if len(output.Streams) == 0 {
-		return "", errors.New("no video streams found")
+		return videoMediaInfo{}, errors.New("no video streams found")
+	}
+
+	stream := output.Streams[0]
+	for _, s := range output.Streams {
+		if s.CodecType == "video" {
+			stream = s
+			break
+		}
 	}
 
-	width := output.Streams[0].Width
-	height := output.Streams[0].Height
+	info := videoMediaInfo{
+		Width:       stream.Width,
+		Height:      stream.Height,
+		AspectRatio: aspectRatio(stream.Width, stream.Height),
+	}
+	if stream.Duration != "" {
+		info.DurationSeconds, _ = strconv.ParseFloat(stream.Duration, 64)
+	}
+	return info, nil
+}
 
+func aspectRatio(width, height int) string {
 	if width == 16*height/9 {
-		return "16:9", nil
+		return "16:9"
 	} else if height == 16*width/9 {
-		return "9:16", nil
+		return "9:16"
 	}
-	return "other", nil
+	return "other"
 }
 
 func processVideoForFastStart(inputFilePath string) (string, error) {
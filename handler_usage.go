@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerUsageGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.StorageUsage
+		QuotaBytes int64 `json:"quota_bytes"`
+	}
+
+	userID := requestUserID(r)
+
+	usage, err := cfg.db.GetStorageUsage(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		StorageUsage: usage,
+		QuotaBytes:   cfg.userStorageQuota,
+	})
+}
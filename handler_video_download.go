@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const downloadURLExpiry = 5 * time.Minute
+
+// handlerVideoDownload sends the current video file as an attachment named
+// after the file that was uploaded, to anyone who can see the video. With
+// ?redirect=true, backends that support it redirect to a short-lived URL so
+// the file doesn't go through the server.
+func (cfg *apiConfig) handlerVideoDownload(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoView)
+	if !ok {
+		return
+	}
+
+	asset, err := cfg.currentVideoAsset(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video file", err)
+		return
+	}
+	if asset.StorageKey == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no file", nil)
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": downloadFilename(asset),
+	})
+
+	if r.URL.Query().Get("redirect") == "true" {
+		store, err := cfg.backend(asset.Backend)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open storage", err)
+			return
+		}
+		if presigner, ok := store.(storage.Presigner); ok {
+			url, err := presigner.PresignGet(r.Context(), asset.StorageKey, disposition, downloadURLExpiry)
+			if err == nil {
+				http.Redirect(w, r, url, http.StatusFound)
+				return
+			}
+			if !errors.Is(err, storage.ErrPresignUnsupported) {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't create download URL", err)
+				return
+			}
+		}
+	}
+
+	contentType := asset.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	cfg.serveAsset(w, r, asset, contentType, disposition)
+}
+
+// downloadFilename is the name a downloaded asset is saved as: the name it was
+// uploaded with, or the storage key for files uploaded before those were kept.
+func downloadFilename(asset database.Asset) string {
+	name := path.Base(strings.ReplaceAll(asset.OriginalFilename, `\`, "/"))
+	if name == "." || name == "/" {
+		name = path.Base(asset.StorageKey)
+	}
+	return name
+}
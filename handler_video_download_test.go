@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestHandlerVideoDownload(t *testing.T) {
+	cfg, _, video := newStorageTestConfig(t)
+	if err := cfg.localStore.Put(context.Background(), "video.mp4", strings.NewReader("movie"), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	asset, err := cfg.db.CreateAsset(database.CreateAssetParams{
+		UserID:           video.UserID,
+		VideoID:          video.ID,
+		Category:         database.AssetCategoryVideo,
+		StorageKey:       "video.mp4",
+		Size:             5,
+		Backend:          localBackend,
+		OriginalFilename: "My cats.mp4",
+		ContentType:      "video/mp4",
+	})
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	if _, err := cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{VideoID: video.ID, AssetID: asset.ID, UploadedBy: video.UserID}); err != nil {
+		t.Fatalf("CreateVideoVersion: %v", err)
+	}
+
+	// Requests aren't authenticated, as for a viewer who isn't logged in.
+	download := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/download", nil)
+		r.SetPathValue("videoID", video.ID.String())
+		w := httptest.NewRecorder()
+		cfg.handlerVideoDownload(w, r)
+		return w
+	}
+
+	for _, visibility := range []database.VideoVisibility{database.VideoPublic, database.VideoUnlisted} {
+		setTestVideoVisibility(t, cfg, video.ID, visibility)
+		w := download()
+		if w.Code != http.StatusOK || w.Body.String() != "movie" {
+			t.Errorf("downloading a %s video = %d %q, want the file", visibility, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="My cats.mp4"` {
+			t.Errorf("Content-Disposition = %q", got)
+		}
+	}
+
+	setTestVideoVisibility(t, cfg, video.ID, database.VideoPrivate)
+	if w := download(); w.Code != http.StatusNotFound {
+		t.Errorf("downloading another user's private video = %d, want 404", w.Code)
+	}
+}
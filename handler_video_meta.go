@@ -2,9 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
@@ -14,25 +21,31 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID := requestUserID(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	params.UserID = userID
+	params.Title, err = validateVideoTitle(params.Title)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
 		return
 	}
-
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+	if err := validateVideoDescription(params.Description); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
 		return
 	}
-	params.UserID = userID
+	if params.Visibility != "" {
+		if _, err := parseVideoVisibility(string(params.Visibility)); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -40,83 +53,344 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, video)
+	respondWithJSON(w, http.StatusCreated, cfg.videoResponse(video))
 }
 
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	// The files are hidden first, so a failure leaves a live video that can
+	// be deleted again rather than a trashed one still served by the CDN.
+	err := cfg.moveVideoMedia(r.Context(), video.ID, false)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hide video files", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	err = cfg.db.TrashVideo(video.ID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video to trash", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	// Private videos look the same as missing ones to everyone but their owner.
+	video, ok := cfg.loadVideo(w, r, videoView)
+	if !ok {
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 10000
+)
+
+// validateVideoTitle checks a title a user gave a video and returns it with
+// surrounding whitespace removed.
+func validateVideoTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return "", fmt.Errorf("title must be between 1 and %d characters", maxVideoTitleLength)
+	}
+	return title, nil
+}
+
+func validateVideoDescription(description string) error {
+	if len(description) > maxVideoDescriptionLength {
+		return fmt.Errorf("description can't be longer than %d bytes", maxVideoDescriptionLength)
+	}
+	return nil
+}
+
+// videoETag identifies a version of a video by its updated_at. Every write to
+// the video moves updated_at forward, so it changes whenever the video does.
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%d"`, video.UpdatedAt.UnixNano())
+}
+
+// ifMatch reports whether an If-Match header allows changing a resource with
+// the given ETag. A missing header allows it.
+func ifMatch(header, etag string) bool {
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerVideoMetaUpdate applies a JSON Merge Patch (RFC 7396) to a video's
+// title, description and visibility. Sending the video's ETag in If-Match makes the
+// update fail with 412 if someone else changed the video in the meantime.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", err)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+	patch := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+	if !ifMatch(r.Header.Get("If-Match"), videoETag(video)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was read", nil)
+		return
+	}
+	for field, value := range patch {
+		isNull := string(value) == "null"
+		switch field {
+		case "title":
+			if isNull {
+				respondWithError(w, http.StatusUnprocessableEntity, "title can't be removed", nil)
+				return
+			}
+			if err := json.Unmarshal(value, &video.Title); err != nil {
+				respondWithError(w, http.StatusBadRequest, "title must be a string", err)
+				return
+			}
+			video.Title, err = validateVideoTitle(video.Title)
+			if err != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+				return
+			}
+		case "description":
+			if isNull {
+				video.Description = ""
+				continue
+			}
+			if err := json.Unmarshal(value, &video.Description); err != nil {
+				respondWithError(w, http.StatusBadRequest, "description must be a string", err)
+				return
+			}
+			if err := validateVideoDescription(video.Description); err != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+				return
+			}
+		case "visibility":
+			if video.TakenDownAt != nil {
+				respondWithError(w, http.StatusForbidden, "Video was taken down by a moderator and must stay private", nil)
+				return
+			}
+			var visibility string
+			if isNull || json.Unmarshal(value, &visibility) != nil {
+				respondWithError(w, http.StatusBadRequest, "visibility must be a string", nil)
+				return
+			}
+			video.Visibility, err = parseVideoVisibility(visibility)
+			if err != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+				return
+			}
+		default:
+			respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s can't be changed", field), nil)
+			return
+		}
+	}
+
+	if len(patch) > 0 {
+		// Someone may have written to the video since the If-Match check.
+		err := cfg.db.UpdateVideoIfUnchanged(video)
+		if errors.Is(err, database.ErrVideoChanged) {
+			respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was read", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+			return
+		}
+		video, err = cfg.db.GetVideo(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+	}
+	if _, ok := patch["visibility"]; ok {
+		// Moves the files out of the CDN's reach when the video stops being
+		// public, and back when it becomes public. Sending the same
+		// visibility again retries a move that failed.
+		if err := cfg.syncVideoMedia(r.Context(), video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't move video files", err)
+			return
+		}
+		video, ok = cfg.reloadVideo(w, video.ID)
+		if !ok {
+			return
+		}
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
 }
 
-func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
+func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := parseListVideosParams(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	params.UserID = userID
 
-	video, err := cfg.db.GetVideo(videoID)
+	page, err := cfg.db.ListVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	// No es necesario modificar la URL, ya que se almacena directamente como URL de CloudFront
-	respondWithJSON(w, http.StatusOK, video)
+	// No es necesario modificar las URLs, ya que se almacenan directamente como URLs de CloudFront
+	page.Videos = cfg.videosResponse(page.Videos)
+	respondWithJSON(w, http.StatusOK, page)
 }
 
-func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+const (
+	defaultVideoPageSize = 50
+	maxVideoPageSize     = 100
+)
+
+// parseListVideosParams reads the paging, sorting and filtering options of
+// the video list from its query string.
+func parseListVideosParams(query url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		Sort:        database.VideoSortCreated,
+		Limit:       defaultVideoPageSize,
+		Cursor:      query.Get("cursor"),
+		Orientation: database.VideoOrientation(query.Get("orientation")),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		params.Limit = n
+	}
+
+	switch sort := database.VideoSort(query.Get("sort")); sort {
+	case "":
+	case database.VideoSortCreated, database.VideoSortUpdated, database.VideoSortDuration:
+		params.Sort = sort
+	case database.VideoSortTitle:
+		params.Sort = sort
+		params.Ascending = true
+	default:
+		return params, fmt.Errorf("sort must be one of created, updated, title or duration")
+	}
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		params.Ascending = true
+	case "desc":
+		params.Ascending = false
+	default:
+		return params, fmt.Errorf("order must be asc or desc")
+	}
+
+	if visibility := query.Get("visibility"); visibility != "" {
+		v, err := parseVideoVisibility(visibility)
+		if err != nil {
+			return params, err
+		}
+		params.Visibility = v
+	}
+
+	switch params.Orientation {
+	case "", database.VideoOrientationLandscape, database.VideoOrientationPortrait, database.VideoOrientationOther:
+	default:
+		return params, fmt.Errorf("orientation must be landscape, portrait or other")
+	}
+
+	if hasVideo := query.Get("has_video"); hasVideo != "" {
+		b, err := strconv.ParseBool(hasVideo)
+		if err != nil {
+			return params, fmt.Errorf("has_video must be true or false")
+		}
+		params.HasVideo = &b
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &params.CreatedAfter,
+		"created_before": &params.CreatedBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			return params, fmt.Errorf("%s must be a date or an RFC 3339 timestamp", name)
+		}
+		*dst = &t
+	}
+
+	for _, value := range query["tag"] {
+		tag, err := normalizeTag(value)
+		if err != nil {
+			return params, err
+		}
+		params.Tags = append(params.Tags, tag)
+	}
+
+	return params, nil
+}
+
+// handlerUserPublicVideos lists a user's public videos. It needs no
+// authentication, and takes the same paging and filtering options as the
+// owner's own list.
+func (cfg *apiConfig) handlerUserPublicVideos(w http.ResponseWriter, r *http.Request) {
+	userIDString := r.PathValue("userID")
+	userID, err := uuid.Parse(userIDString)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	params, err := parseListVideosParams(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	params.UserID = userID
+	params.Visibility = database.VideoPublic
+	params.HideTakenDown = true
 
-	videos, err := cfg.db.GetVideos(userID)
+	page, err := cfg.db.ListVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	// No es necesario modificar las URLs, ya que se almacenan directamente como URLs de CloudFront
-	respondWithJSON(w, http.StatusOK, videos)
+	page.Videos = cfg.videosResponse(page.Videos)
+	respondWithJSON(w, http.StatusOK, page)
 }
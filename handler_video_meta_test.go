@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// asUser authenticates a request as a user, as authMiddleware would.
+func asUser(r *http.Request, userID uuid.UUID) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal{UserID: userID, Role: database.RoleUser}))
+}
+
+// patchVideo sends a PATCH for a video as its owner.
+func patchVideo(cfg *apiConfig, video database.Video, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPatch, "/api/videos/"+video.ID.String(), strings.NewReader(body))
+	r.SetPathValue("videoID", video.ID.String())
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	cfg.handlerVideoMetaUpdate(w, asUser(r, video.UserID))
+	return w
+}
+
+func TestHandlerVideoMetaUpdateHidesMedia(t *testing.T) {
+	cfg, recorder, video := newStorageTestConfig(t)
+	createTestAsset(t, cfg, video, database.AssetCategoryThumbnail, s3Backend(cfg.s3Bucket), "thumb.png")
+	createTestAsset(t, cfg, video, database.AssetCategoryVideo, s3Backend(cfg.s3Bucket), "video.mp4")
+	publishedURL := cfg.backendURL(s3Backend(cfg.s3Bucket), "video.mp4")
+	if err := cfg.db.SetVideoURL(video.ID, publishedURL); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, visibility := range []string{"unlisted", "private"} {
+		if w := patchVideo(cfg, video, `{"visibility": "`+visibility+`"}`, nil); w.Code != http.StatusOK {
+			t.Fatalf("making the video %s = %d: %s", visibility, w.Code, w.Body)
+		}
+		assertHidden(t, cfg, video.ID, publishedURL, "thumb.png", "video.mp4")
+	}
+	assertPurged(t, recorder, "thumb.png", "video.mp4")
+
+	if w := patchVideo(cfg, video, `{"visibility": "public"}`, nil); w.Code != http.StatusOK {
+		t.Fatalf("making the video public = %d: %s", w.Code, w.Body)
+	}
+	if got, _ := cfg.db.GetVideo(video.ID); got.VideoURL == nil || *got.VideoURL != publishedURL {
+		t.Errorf("video URL after making it public again = %v, want %s", got.VideoURL, publishedURL)
+	}
+}
+
+func TestHandlerVideoMetaCreate(t *testing.T) {
+	cfg, _, video := newStorageTestConfig(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantTitle  string
+	}{
+		{"valid", `{"title": "  dogs  ", "description": "woof"}`, http.StatusCreated, "dogs"},
+		{"malformed JSON", `{"title": `, http.StatusBadRequest, ""},
+		{"wrong type", `{"title": 1}`, http.StatusBadRequest, ""},
+		{"missing title", `{"description": "woof"}`, http.StatusUnprocessableEntity, ""},
+		{"blank title", `{"title": "   "}`, http.StatusUnprocessableEntity, ""},
+		{"long title", `{"title": "` + strings.Repeat("é", maxVideoTitleLength+1) + `"}`, http.StatusUnprocessableEntity, ""},
+		{"title at the limit", `{"title": "` + strings.Repeat("é", maxVideoTitleLength) + `"}`, http.StatusCreated, strings.Repeat("é", maxVideoTitleLength)},
+		{"long description", `{"title": "dogs", "description": "` + strings.Repeat("x", maxVideoDescriptionLength+1) + `"}`, http.StatusUnprocessableEntity, ""},
+		{"unknown visibility", `{"title": "dogs", "visibility": "secret"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/videos", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			cfg.handlerVideoMetaCreate(w, asUser(r, video.UserID))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var created database.Video
+			if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			if created.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", created.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoMetaUpdate(t *testing.T) {
+	cfg, _, video := newStorageTestConfig(t)
+	etags := map[string]bool{videoETag(video): true}
+	firstETag := videoETag(video)
+
+	// patch sends a patch that must succeed and checks the ETag it returns is
+	// new and matches the stored video.
+	patch := func(body string, header http.Header) database.Video {
+		t.Helper()
+		w := patchVideo(cfg, video, body, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s = %d: %s", body, w.Code, w.Body)
+		}
+		got, err := cfg.db.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		etag := w.Header().Get("ETag")
+		if etag != videoETag(got) {
+			t.Errorf("PATCH %s: ETag = %s, want %s", body, etag, videoETag(got))
+		}
+		if etags[etag] {
+			t.Errorf("PATCH %s: ETag %s didn't change", body, etag)
+		}
+		etags[etag] = true
+		return got
+	}
+
+	got := patch(`{"description": "meow"}`, nil)
+	if got.Title != "cats" || got.Description != "meow" {
+		t.Errorf("after setting the description: title %q, description %q", got.Title, got.Description)
+	}
+	got = patch(`{"title": " kittens "}`, http.Header{"If-Match": {videoETag(got)}})
+	if got.Title != "kittens" || got.Description != "meow" {
+		t.Errorf("after setting the title: title %q, description %q, want the description kept", got.Title, got.Description)
+	}
+	got = patch(`{"description": null}`, http.Header{"If-Match": {`"bogus", ` + videoETag(got)}})
+	if got.Title != "kittens" || got.Description != "" {
+		t.Errorf("after removing the description: title %q, description %q", got.Title, got.Description)
+	}
+	got = patch(`{"visibility": "unlisted"}`, http.Header{"If-Match": {"*"}})
+	if got.Visibility != database.VideoUnlisted {
+		t.Errorf("visibility = %s, want unlisted", got.Visibility)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		ifMatch     string
+		wantStatus  int
+	}{
+		{"stale If-Match", `{"title": "dogs"}`, "", firstETag, http.StatusPreconditionFailed},
+		{"unmatched If-Match", `{"title": "dogs"}`, "", `"bogus"`, http.StatusPreconditionFailed},
+		{"plain text", `{"title": "dogs"}`, "text/plain", "", http.StatusUnsupportedMediaType},
+		{"no Content-Type", `{"title": "dogs"}`, "none", "", http.StatusUnsupportedMediaType},
+		{"not an object", `["title"]`, "", "", http.StatusBadRequest},
+		{"removing the title", `{"title": null}`, "", "", http.StatusUnprocessableEntity},
+		{"blank title", `{"title": " "}`, "", "", http.StatusUnprocessableEntity},
+		{"long description", `{"description": "` + strings.Repeat("x", maxVideoDescriptionLength+1) + `"}`, "", "", http.StatusUnprocessableEntity},
+		{"unknown visibility", `{"visibility": "secret"}`, "", "", http.StatusUnprocessableEntity},
+		{"read-only field", `{"user_id": "` + uuid.NewString() + `"}`, "", "", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.ifMatch != "" {
+				header.Set("If-Match", tt.ifMatch)
+			}
+			switch tt.contentType {
+			case "":
+			case "none":
+				header["Content-Type"] = nil
+			default:
+				header.Set("Content-Type", tt.contentType)
+			}
+			w := patchVideo(cfg, video, tt.body, header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			after, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if videoETag(after) != videoETag(got) {
+				t.Errorf("rejected patch changed the video: %+v", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query", nil)
+		return
+	}
+	limit := defaultVideoPageSize
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxVideoPageSize {
+			err = fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	page, err := cfg.db.SearchVideos(database.SearchVideosParams{
+		UserID: userID,
+		Query:  q,
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+	})
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i := range page.Results {
+		page.Results[i].Video = cfg.videoResponse(page.Results[i].Video)
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
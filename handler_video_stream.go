@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// handlerVideoStream proxies a video from storage for deployments where the
+// bucket isn't public, and for videos that aren't public, to anyone who can
+// see the video or has a signed URL for it. Range requests are passed through
+// to the backend so players can seek without the whole file being read.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadMediaVideo(w, r)
+	if !ok {
+		return
+	}
+
+	asset, err := cfg.currentVideoAsset(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video file", err)
+		return
+	}
+	if asset.StorageKey == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no file", nil)
+		return
+	}
+
+	cfg.serveAsset(w, r, asset, "video/mp4", "")
+}
+
+// handlerVideoThumbnail serves a video's thumbnail like handlerVideoStream
+// serves its file.
+func (cfg *apiConfig) handlerVideoThumbnail(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadMediaVideo(w, r)
+	if !ok {
+		return
+	}
+
+	asset, err := cfg.currentThumbnailAsset(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find thumbnail", err)
+		return
+	}
+	if asset.StorageKey == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no thumbnail", nil)
+		return
+	}
+
+	cfg.serveAsset(w, r, asset, "application/octet-stream", "")
+}
+
+// serveAsset proxies an asset from its backend, passing range requests
+// through so only the requested bytes are read. A non-empty disposition is
+// sent as the Content-Disposition header.
+func (cfg *apiConfig) serveAsset(w http.ResponseWriter, r *http.Request, asset database.Asset, defaultContentType, disposition string) {
+	store, err := cfg.backend(asset.Backend)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open storage", err)
+		return
+	}
+	obj, err := store.Head(r.Context(), asset.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "File is missing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read file", err)
+		return
+	}
+
+	etag := obj.ETag
+	if etag == "" && asset.Checksum != "" {
+		etag = `"` + asset.Checksum + `"`
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private")
+	if disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+
+	content := storage.NewReadSeeker(r.Context(), store, asset.StorageKey, obj.Size)
+	defer content.Close()
+	http.ServeContent(w, r, path.Base(asset.StorageKey), obj.LastModified, content)
+}
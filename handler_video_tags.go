@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxTagLength = 50
+
+// normalizeTag lowercases and trims a tag name so "Cats " and "cats" are the
+// same tag.
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		return "", errors.New("tags must be between 1 and 50 characters")
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+			return "", errors.New("tags can only contain letters, digits, spaces, - and _")
+		}
+	}
+	return name, nil
+}
+
+func (cfg *apiConfig) handlerVideoTagsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+
+	tags, err := cfg.db.GetVideoTags(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) handlerVideoTagAdd(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+	tag, err := normalizeTag(r.PathValue("tag"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if _, err := cfg.db.AddVideoTag(video.UserID, video.ID, tag); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add tag", err)
+		return
+	}
+
+	tags, err := cfg.db.GetVideoTags(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) handlerVideoTagRemove(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+	tag, err := normalizeTag(r.PathValue("tag"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if err := cfg.db.RemoveVideoTag(video.UserID, video.ID, tag); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove tag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUserTagsList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	tags, err := cfg.db.GetUserTags(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerTrashList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := parseListVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = userID
+	params.Trashed = true
+
+	page, err := cfg.db.ListVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trash", err)
+		return
+	}
+
+	page.Videos = cfg.videosResponse(page.Videos)
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func (cfg *apiConfig) handlerTrashRestore(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadTrashedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.RestoreVideo(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	// Public videos are published on the CDN again.
+	if err := cfg.syncVideoMedia(r.Context(), video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video files", err)
+		return
+	}
+
+	video, ok = cfg.reloadVideo(w, video.ID)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
+
+func (cfg *apiConfig) handlerTrashDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadTrashedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.purgeVideo(r.Context(), video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
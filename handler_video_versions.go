@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve versions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, versions)
+}
+
+func (cfg *apiConfig) handlerVideoVersionRollback(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.loadVideo(w, r, videoOwn)
+	if !ok {
+		return
+	}
+	versionIDString := r.PathValue("versionID")
+	versionID, err := uuid.Parse(versionIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid version ID", err)
+		return
+	}
+
+	version, err := cfg.db.GetVideoVersion(versionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get version", err)
+		return
+	}
+	if version.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "Version not found", nil)
+		return
+	}
+
+	err = cfg.db.SetCurrentVideoVersion(video.ID, versionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't roll back video", err)
+		return
+	}
+
+	err = cfg.db.SetVideoURL(video.ID, cfg.backendURL(version.Backend, version.StorageKey))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	// New files are stored at their published keys, which is only where
+	// they belong if the video is public.
+	err = cfg.syncVideoMedia(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video files", err)
+		return
+	}
+	video, ok = cfg.reloadVideo(w, video.ID)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
+
+// pruneVideoVersions deletes the oldest versions of a video, and the files
+// backing them, once there are more than the configured retention. The current
+// version is always kept, even when it is one of the oldest.
+func (cfg *apiConfig) pruneVideoVersions(ctx context.Context, videoID uuid.UUID) error {
+	if cfg.videoVersionRetention <= 0 {
+		return nil
+	}
+
+	versions, err := cfg.db.GetVideoVersions(videoID)
+	if err != nil {
+		return err
+	}
+	if len(versions) <= cfg.videoVersionRetention {
+		return nil
+	}
+
+	deleted := []database.Asset{}
+	for _, version := range versions[cfg.videoVersionRetention:] {
+		if version.Current {
+			continue
+		}
+		asset, err := cfg.db.GetAsset(version.AssetID)
+		if err != nil {
+			return err
+		}
+		if err := cfg.deleteAssetObject(ctx, asset); err != nil {
+			return fmt.Errorf("couldn't delete version %d: %w", version.Version, err)
+		}
+		if err := cfg.db.DeleteVideoVersion(version.ID); err != nil {
+			return err
+		}
+		if err := cfg.db.DeleteAsset(asset.ID); err != nil {
+			return err
+		}
+		deleted = append(deleted, asset)
+	}
+	return cfg.purgeCDN(ctx, deleted)
+}
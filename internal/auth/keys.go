@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+// Key is a key access tokens are signed or verified with. Keys parsed from a
+// public key can only verify.
+type Key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+func (k Key) ID() string {
+	return k.id
+}
+
+// ParseKey parses a PEM encoded RSA or Ed25519 key. RSA keys sign with RS256
+// and Ed25519 keys with EdDSA.
+func ParseKey(id string, data []byte) (Key, error) {
+	if id == "" {
+		return Key{}, errors.New("key ID can't be empty")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q isn't PEM encoded", id)
+	}
+
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("couldn't parse key %q: %w", id, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return Key{}, fmt.Errorf("key %q must be an RSA or Ed25519 key, got %T", id, key)
+		}
+		private = key
+		public = signer.Public()
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("couldn't parse key %q: %w", id, err)
+		}
+		private = key
+		public = key.Public()
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("couldn't parse key %q: %w", id, err)
+		}
+		public = key
+	default:
+		return Key{}, fmt.Errorf("key %q has unsupported PEM type %q", id, block.Type)
+	}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return Key{}, fmt.Errorf("RSA key %q must be at least %d bits", id, minRSAKeyBits)
+		}
+		return Key{id: id, method: jwt.SigningMethodRS256, private: private, public: public}, nil
+	case ed25519.PublicKey:
+		return Key{id: id, method: jwt.SigningMethodEdDSA, private: private, public: public}, nil
+	default:
+		return Key{}, fmt.Errorf("key %q must be an RSA or Ed25519 key, got %T", id, public)
+	}
+}
+
+// KeySet holds the keys for access tokens. Tokens are signed with the active
+// key and name it in their kid header; the other keys are kept so tokens
+// signed before a rotation still validate until they expire.
+type KeySet struct {
+	active Key
+	keys   map[string]Key
+}
+
+// NewKeySet makes a key set from keys, the first of which is the active one
+// and must be a private key.
+func NewKeySet(keys []Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key set needs at least one key")
+	}
+	if keys[0].private == nil {
+		return nil, fmt.Errorf("active key %q must be a private key", keys[0].id)
+	}
+	ks := &KeySet{active: keys[0], keys: map[string]Key{}}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.id)
+		}
+		ks.keys[key.id] = key
+	}
+	return ks, nil
+}
+
+// NewHMACKeySet makes a key set that signs and verifies with a shared secret
+// using HS256. Its tokens carry no kid, and it has no public keys to publish.
+func NewHMACKeySet(secret string) *KeySet {
+	key := Key{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &KeySet{active: key, keys: map[string]Key{"": key}}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.id != "" {
+		token.Header["kid"] = ks.active.id
+	}
+	return token.SignedString(ks.active.private)
+}
+
+// verificationKey finds the key a token names. The algorithm is taken from the
+// key, never from the token, so a token can't pick how it is checked.
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q doesn't sign with %s", kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+func (ks *KeySet) methods() []string {
+	var methods []string
+	seen := map[string]bool{}
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS lists the public keys tokens can be verified with, so other services
+// can check them without a shared secret. HMAC keys aren't included.
+func (ks *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KeyID < jwks[j].KeyID })
+	return jwks
+}
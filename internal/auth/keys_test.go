@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type testKeyPair struct {
+	private    Key
+	public     Key
+	publicPEM  []byte
+	privateKey interface{}
+}
+
+func newRSATestKey(t *testing.T, id string) testKeyPair {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return newTestKeyPair(t, id, priv, &priv.PublicKey)
+}
+
+func newEd25519TestKey(t *testing.T, id string) testKeyPair {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	return newTestKeyPair(t, id, priv, pub)
+}
+
+func newTestKeyPair(t *testing.T, id string, priv, pub interface{}) testKeyPair {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	privKey, err := ParseKey(id, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	if err != nil {
+		t.Fatalf("ParseKey(private): %v", err)
+	}
+	pubKey, err := ParseKey(id, pubPEM)
+	if err != nil {
+		t.Fatalf("ParseKey(public): %v", err)
+	}
+	return testKeyPair{private: privKey, public: pubKey, publicPEM: pubPEM, privateKey: priv}
+}
+
+func newTestKeySet(t *testing.T, keys ...Key) *KeySet {
+	t.Helper()
+	ks, err := NewKeySet(keys)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return ks
+}
+
+func testClaims(userID uuid.UUID) accessClaims {
+	now := time.Now().UTC()
+	return accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		Subject:   userID.String(),
+	}}
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey := newRSATestKey(t, "rsa")
+	if rsaKey.private.method != jwt.SigningMethodRS256 || rsaKey.private.private == nil {
+		t.Errorf("RSA private key: method %v, private %v", rsaKey.private.method, rsaKey.private.private != nil)
+	}
+	if rsaKey.public.private != nil {
+		t.Error("key parsed from a public key can sign")
+	}
+	edKey := newEd25519TestKey(t, "ed")
+	if edKey.private.method != jwt.SigningMethodEdDSA {
+		t.Errorf("Ed25519 key method = %v, want EdDSA", edKey.private.method)
+	}
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	smallPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(small)})
+
+	tests := []struct {
+		name string
+		id   string
+		data []byte
+	}{
+		{"empty ID", "", rsaKey.publicPEM},
+		{"not PEM", "bad", []byte("not a key")},
+		{"unsupported PEM type", "bad", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})},
+		{"short RSA key", "small", smallPEM},
+	}
+	for _, tt := range tests {
+		if _, err := ParseKey(tt.id, tt.data); err == nil {
+			t.Errorf("%s: ParseKey succeeded, want error", tt.name)
+		}
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	key := newEd25519TestKey(t, "a")
+	if _, err := NewKeySet(nil); err == nil {
+		t.Error("NewKeySet(nil) succeeded, want error")
+	}
+	if _, err := NewKeySet([]Key{key.public}); err == nil {
+		t.Error("NewKeySet with a public active key succeeded, want error")
+	}
+	if _, err := NewKeySet([]Key{key.private, key.public}); err == nil {
+		t.Error("NewKeySet with duplicate IDs succeeded, want error")
+	}
+}
+
+func TestValidateJWTRotation(t *testing.T) {
+	oldKey := newRSATestKey(t, "old")
+	newKey := newEd25519TestKey(t, "new")
+	userID := uuid.New()
+
+	oldToken, err := MakeJWT(userID, "session", newTestKeySet(t, oldKey.private), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	// After rotating, the old key is only kept as a public key.
+	rotated := newTestKeySet(t, newKey.private, oldKey.public)
+	newToken, err := MakeJWT(userID, "session", rotated, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		got, err := ValidateJWT(token, rotated)
+		if err != nil {
+			t.Errorf("%s token: ValidateJWT: %v", name, err)
+			continue
+		}
+		if got.UserID != userID || got.SessionID != "session" {
+			t.Errorf("%s token: got %+v", name, got)
+		}
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &accessClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if parsed.Header["kid"] != "new" || parsed.Header["alg"] != "EdDSA" {
+		t.Errorf("header = %v, want kid new and alg EdDSA", parsed.Header)
+	}
+}
+
+func TestValidateJWTRejectsForgedTokens(t *testing.T) {
+	rsaKey := newRSATestKey(t, "rsa")
+	edKey := newEd25519TestKey(t, "ed")
+	ks := newTestKeySet(t, rsaKey.private, edKey.public)
+	claims := testClaims(uuid.New())
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+	other := newRSATestKey(t, "other")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// The classic algorithm confusion attack: the RSA public key is no
+		// secret, so an HS256 token keyed with it must not verify.
+		{"HS256 keyed with the RSA public key", sign(jwt.SigningMethodHS256, "rsa", rsaKey.publicPEM)},
+		{"HS256 keyed with the RSA public key without kid", sign(jwt.SigningMethodHS256, "", rsaKey.publicPEM)},
+		{"alg none", sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown kid", sign(jwt.SigningMethodRS256, "other", other.privateKey)},
+		{"no kid", sign(jwt.SigningMethodRS256, "", rsaKey.privateKey)},
+		{"kid naming a key with another algorithm", sign(jwt.SigningMethodRS256, "ed", rsaKey.privateKey)},
+		{"signed by another key under a known kid", sign(jwt.SigningMethodRS256, "rsa", other.privateKey)},
+	}
+	for _, tt := range tests {
+		if _, err := ValidateJWT(tt.token, ks); err == nil {
+			t.Errorf("%s: ValidateJWT succeeded, want error", tt.name)
+		}
+	}
+}
+
+func TestHMACKeySet(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+
+	token, err := MakeJWT(userID, "", ks, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &accessClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if _, ok := parsed.Header["kid"]; ok {
+		t.Errorf("HMAC token has a kid header: %v", parsed.Header)
+	}
+	got, err := ValidateJWT(token, ks)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	if got.UserID != userID {
+		t.Errorf("UserID = %v, want %v", got.UserID, userID)
+	}
+
+	if _, err := ValidateJWT(token, NewHMACKeySet("other secret")); err == nil {
+		t.Error("token validated with another secret")
+	}
+	rsaToken, err := MakeJWT(userID, "", newTestKeySet(t, newRSATestKey(t, "rsa").private), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	if _, err := ValidateJWT(rsaToken, ks); err == nil {
+		t.Error("RS256 token validated against an HMAC key set")
+	}
+	if jwks := ks.JWKS(); len(jwks) != 0 {
+		t.Errorf("JWKS = %+v, want no keys", jwks)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey := newRSATestKey(t, "rsa")
+	edKey := newEd25519TestKey(t, "ed")
+	retired := newRSATestKey(t, "retired")
+	ks := newTestKeySet(t, rsaKey.private, edKey.private, retired.public)
+
+	jwks := ks.JWKS()
+	if len(jwks) != 3 {
+		t.Fatalf("JWKS has %d keys, want 3", len(jwks))
+	}
+	byID := map[string]JWK{}
+	for _, jwk := range jwks {
+		byID[jwk.KeyID] = jwk
+	}
+
+	rsaJWK := byID["rsa"]
+	pub := rsaKey.privateKey.(*rsa.PrivateKey).PublicKey
+	if rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" ||
+		rsaJWK.N != base64.RawURLEncoding.EncodeToString(pub.N.Bytes()) ||
+		rsaJWK.E != base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()) {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	edJWK := byID["ed"]
+	edPub := edKey.privateKey.(ed25519.PrivateKey).Public().(ed25519.PublicKey)
+	if edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || edJWK.Algorithm != "EdDSA" ||
+		edJWK.X != base64.RawURLEncoding.EncodeToString(edPub) {
+		t.Errorf("Ed25519 JWK = %+v", edJWK)
+	}
+	if byID["retired"].KeyType != "RSA" {
+		t.Errorf("retired JWK = %+v", byID["retired"])
+	}
+
+	// Only public parameters may be published.
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	for _, field := range []string{`"d"`, `"p"`, `"q"`, `"dp"`, `"dq"`, `"qi"`, `"k"`} {
+		if strings.Contains(string(data), field) {
+			t.Errorf("JWKS contains private field %s: %s", field, data)
+		}
+	}
+}
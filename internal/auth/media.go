@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrMediaURLUnsigned = errors.New("media URL isn't signed")
+	ErrMediaURLExpired  = errors.New("media URL expired")
+	ErrMediaURLInvalid  = errors.New("media URL signature is invalid")
+)
+
+// SignMediaURL returns the query parameters that let anyone holding them GET
+// path until expires. The signature covers the path, so a signed URL can't be
+// reused for other files.
+func SignMediaURL(key []byte, path string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"expires":   {exp},
+		"signature": {mediaSignature(key, path, exp)},
+	}
+}
+
+// VerifyMediaURL checks query carries a signature for path that hasn't
+// expired.
+func VerifyMediaURL(key []byte, path string, query url.Values) error {
+	exp, signature := query.Get("expires"), query.Get("signature")
+	if exp == "" || signature == "" {
+		return ErrMediaURLUnsigned
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrMediaURLInvalid
+	}
+	if !hmac.Equal([]byte(signature), []byte(mediaSignature(key, path, exp))) {
+		return ErrMediaURLInvalid
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return ErrMediaURLExpired
+	}
+	return nil
+}
+
+func mediaSignature(key []byte, path, expires string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
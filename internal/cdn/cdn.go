@@ -0,0 +1,92 @@
+// Package cdn removes stale copies of media from the CDN in front of storage
+// after it is replaced or deleted.
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+type Purger interface {
+	// Purge removes the objects at the given keys from the CDN's caches.
+	Purge(ctx context.Context, keys []string) error
+}
+
+// Noop is used when there is no CDN to purge.
+type Noop struct{}
+
+func (Noop) Purge(ctx context.Context, keys []string) error {
+	return nil
+}
+
+// Recorder remembers every key it is asked to purge instead of contacting a
+// CDN.
+type Recorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *Recorder) Purge(ctx context.Context, keys []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, keys...)
+	return nil
+}
+
+// Keys returns the keys purged so far.
+func (r *Recorder) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.keys...)
+}
+
+// CloudFront only allows a limited number of file paths in invalidations
+// that are in progress at once, so large purges are split into batches.
+const maxPathsPerInvalidation = 1000
+
+type CloudFront struct {
+	client         *cloudfront.Client
+	distributionID string
+}
+
+func NewCloudFront(client *cloudfront.Client, distributionID string) *CloudFront {
+	return &CloudFront{client: client, distributionID: distributionID}
+}
+
+func (c *CloudFront) Purge(ctx context.Context, keys []string) error {
+	paths := make([]string, 0, len(keys))
+	seen := map[string]bool{}
+	for _, key := range keys {
+		p := (&url.URL{Path: "/" + strings.TrimPrefix(key, "/")}).EscapedPath()
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for start := 0; start < len(paths); start += maxPathsPerInvalidation {
+		batch := paths[start:min(start+maxPathsPerInvalidation, len(paths))]
+		_, err := c.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+			DistributionId: aws.String(c.distributionID),
+			InvalidationBatch: &types.InvalidationBatch{
+				CallerReference: aws.String(fmt.Sprintf("tubely-%d-%d", time.Now().UnixNano(), start)),
+				Paths: &types.Paths{
+					Quantity: aws.Int32(int32(len(batch))),
+					Items:    batch,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't invalidate %d paths: %w", len(batch), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey is a long-lived credential a user creates for scripts. The key
+// itself is only known when it is created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	hash string
+}
+
+type CreateAPIKeyParams struct {
+	UserID    uuid.UUID
+	Name      string
+	Key       string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+const apiKeyColumns = `
+		id,
+		created_at,
+		user_id,
+		name,
+		key_prefix,
+		scopes,
+		expires_at,
+		last_used_at,
+		revoked_at,
+		key_hash
+	FROM api_keys`
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.hash,
+	)
+	key.Scopes = strings.Fields(scopes)
+	return key, err
+}
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO api_keys (
+		id,
+		created_at,
+		user_id,
+		name,
+		key_hash,
+		key_prefix,
+		scopes,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(
+		query,
+		id,
+		params.UserID,
+		params.Name,
+		hashToken(params.Key),
+		tokenPrefix(params.Key),
+		strings.Join(params.Scopes, " "),
+		params.ExpiresAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return c.GetAPIKeyByID(id)
+}
+
+// GetAPIKey looks a key up by its prefix and checks it against the stored
+// hashes in constant time. It returns a zero APIKey if there is no match.
+func (c Client) GetAPIKey(key string) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	WHERE key_prefix = ?
+	`
+	rows, err := c.db.Query(query, tokenPrefix(key))
+	if err != nil {
+		return APIKey{}, err
+	}
+	defer rows.Close()
+
+	hash := hashToken(key)
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			return APIKey{}, err
+		}
+		if subtle.ConstantTimeCompare([]byte(apiKey.hash), []byte(hash)) == 1 {
+			return apiKey, nil
+		}
+	}
+	return APIKey{}, rows.Err()
+}
+
+// GetAPIKeyByID returns a zero APIKey if there is no key with the ID.
+func (c Client) GetAPIKeyByID(id uuid.UUID) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	WHERE id = ?
+	`
+	key, err := scanAPIKey(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, nil
+	}
+	return key, err
+}
+
+// GetAPIKeys lists a user's keys that haven't been revoked, newest first.
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	WHERE user_id = ? AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c Client) RevokeAPIKey(id uuid.UUID) error {
+	query := `
+	UPDATE api_keys
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// TouchAPIKey records that a key was just used.
+func (c Client) TouchAPIKey(id uuid.UUID) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAPIKeys(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		secret := "tubely_" + uuid.NewString()
+		key, err := c.CreateAPIKey(CreateAPIKeyParams{UserID: user.ID, Name: "ci", Key: secret, Scopes: []string{"videos:read", "videos:write"}, ExpiresAt: &expires})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if key.Name != "ci" || key.Prefix != secret[:tokenPrefixLength] || len(key.Scopes) != 2 || key.Scopes[1] != "videos:write" || key.ExpiresAt == nil || !key.ExpiresAt.Equal(expires) {
+			t.Errorf("CreateAPIKey returned %+v", key)
+		}
+		if key.hash == secret {
+			t.Error("the key is stored in the clear")
+		}
+
+		// A key with the same prefix must not match the other's hash.
+		twin := secret[:tokenPrefixLength] + uuid.NewString()
+		if _, err := c.CreateAPIKey(CreateAPIKeyParams{UserID: user.ID, Name: "twin", Key: twin}); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name string
+			key  string
+			want uuid.UUID
+		}{
+			{"the key", secret, key.ID},
+			{"same prefix", secret[:tokenPrefixLength] + "wrong", uuid.Nil},
+			{"unknown", "unknown-key", uuid.Nil},
+			{"empty", "", uuid.Nil},
+		}
+		for _, tt := range tests {
+			got, err := c.GetAPIKey(tt.key)
+			if err != nil || got.ID != tt.want {
+				t.Errorf("%s: GetAPIKey = %v, %v; want %v", tt.name, got.ID, err, tt.want)
+			}
+		}
+
+		if err := c.TouchAPIKey(key.ID); err != nil {
+			t.Fatalf("TouchAPIKey: %v", err)
+		}
+		if got, _ := c.GetAPIKeyByID(key.ID); got.LastUsedAt == nil {
+			t.Error("TouchAPIKey didn't record the use")
+		}
+
+		if keys, err := c.GetAPIKeys(user.ID); err != nil || len(keys) != 2 {
+			t.Errorf("GetAPIKeys = %d keys, %v", len(keys), err)
+		}
+		if err := c.RevokeAPIKey(key.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		revoked, _ := c.GetAPIKey(secret)
+		if revoked.RevokedAt == nil {
+			t.Error("key isn't revoked")
+		}
+		if keys, _ := c.GetAPIKeys(user.ID); len(keys) != 1 || keys[0].Name != "twin" {
+			t.Errorf("GetAPIKeys lists revoked keys: %+v", keys)
+		}
+		if got, err := c.GetAPIKeyByID(uuid.New()); err != nil || got.ID != uuid.Nil {
+			t.Errorf("GetAPIKeyByID of a missing key = %+v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AssetHealthStatus string
+
+const (
+	AssetHealthOK               AssetHealthStatus = "ok"
+	AssetHealthMissing          AssetHealthStatus = "missing"
+	AssetHealthSizeMismatch     AssetHealthStatus = "size_mismatch"
+	AssetHealthChecksumMismatch AssetHealthStatus = "checksum_mismatch"
+	AssetHealthError            AssetHealthStatus = "error"
+)
+
+type AssetHealth struct {
+	AssetID   uuid.UUID         `json:"asset_id"`
+	Status    AssetHealthStatus `json:"status"`
+	Detail    string            `json:"detail"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+type AssetHealthProblem struct {
+	Asset
+	Status    AssetHealthStatus `json:"status"`
+	Detail    string            `json:"detail"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+type AssetHealthReport struct {
+	Counts    map[AssetHealthStatus]int `json:"counts"`
+	Unchecked int                       `json:"unchecked"`
+	Problems  []AssetHealthProblem      `json:"problems"`
+}
+
+// SetAssetHealth records the outcome of the latest check of an asset,
+// replacing the previous one.
+func (c Client) SetAssetHealth(health AssetHealth) error {
+	query := `
+	INSERT INTO asset_health (asset_id, status, detail, checked_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(asset_id) DO UPDATE SET
+		status = excluded.status,
+		detail = excluded.detail,
+		checked_at = excluded.checked_at
+	`
+	_, err := c.db.Exec(query, health.AssetID, health.Status, health.Detail, health.CheckedAt)
+	return err
+}
+
+// GetAssetHealthReport counts assets by their latest health status and lists
+// every asset whose latest check found a problem.
+func (c Client) GetAssetHealthReport() (AssetHealthReport, error) {
+	report := AssetHealthReport{
+		Counts:   map[AssetHealthStatus]int{},
+		Problems: []AssetHealthProblem{},
+	}
+
+	rows, err := c.db.Query(`
+	SELECT COALESCE(h.status, ''), COUNT(*)
+	FROM assets a
+	LEFT JOIN asset_health h ON h.asset_id = a.id
+	GROUP BY h.status
+	`)
+	if err != nil {
+		return AssetHealthReport{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status AssetHealthStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return AssetHealthReport{}, err
+		}
+		if status == "" {
+			report.Unchecked = count
+			continue
+		}
+		report.Counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return AssetHealthReport{}, err
+	}
+
+	query := `
+	SELECT
+		a.id,
+		a.created_at,
+		a.user_id,
+		a.video_id,
+		a.category,
+		a.storage_key,
+		a.size,
+		a.backend,
+		a.checksum,
+		a.original_filename,
+		a.content_type,
+		h.status,
+		h.detail,
+		h.checked_at
+	FROM asset_health h
+	JOIN assets a ON a.id = h.asset_id
+	WHERE h.status != ?
+	ORDER BY h.checked_at DESC
+	`
+	problemRows, err := c.db.Query(query, AssetHealthOK)
+	if err != nil {
+		return AssetHealthReport{}, err
+	}
+	defer problemRows.Close()
+	for problemRows.Next() {
+		var p AssetHealthProblem
+		if err := problemRows.Scan(
+			&p.ID,
+			&p.CreatedAt,
+			&p.UserID,
+			&p.VideoID,
+			&p.Category,
+			&p.StorageKey,
+			&p.Size,
+			&p.Backend,
+			&p.Checksum,
+			&p.OriginalFilename,
+			&p.ContentType,
+			&p.Status,
+			&p.Detail,
+			&p.CheckedAt,
+		); err != nil {
+			return AssetHealthReport{}, err
+		}
+		report.Problems = append(report.Problems, p)
+	}
+
+	return report, problemRows.Err()
+}
@@ -0,0 +1,408 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AssetCategory string
+
+const (
+	AssetCategoryVideo     AssetCategory = "video"
+	AssetCategoryThumbnail AssetCategory = "thumbnail"
+	AssetCategoryRendition AssetCategory = "rendition"
+)
+
+// AssetCategories lists every category usage is reported for.
+var AssetCategories = []AssetCategory{
+	AssetCategoryVideo,
+	AssetCategoryThumbnail,
+	AssetCategoryRendition,
+}
+
+type Asset struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateAssetParams
+}
+
+type CreateAssetParams struct {
+	UserID     uuid.UUID     `json:"user_id"`
+	VideoID    uuid.UUID     `json:"video_id"`
+	Category   AssetCategory `json:"category"`
+	StorageKey string        `json:"storage_key"`
+	Size       int64         `json:"size"`
+	Backend    string        `json:"backend"`
+	Checksum   string        `json:"checksum"`
+	// OriginalFilename and ContentType are what the client sent with the
+	// upload, before any processing.
+	OriginalFilename string `json:"original_filename"`
+	ContentType      string `json:"content_type"`
+}
+
+type StorageUsage struct {
+	TotalBytes int64                   `json:"total_bytes"`
+	Categories map[AssetCategory]int64 `json:"categories"`
+}
+
+const assetColumns = `
+		id,
+		created_at,
+		user_id,
+		video_id,
+		category,
+		storage_key,
+		size,
+		backend,
+		checksum,
+		original_filename,
+		content_type
+	FROM assets`
+
+func scanAsset(row rowScanner) (Asset, error) {
+	var asset Asset
+	err := row.Scan(
+		&asset.ID,
+		&asset.CreatedAt,
+		&asset.UserID,
+		&asset.VideoID,
+		&asset.Category,
+		&asset.StorageKey,
+		&asset.Size,
+		&asset.Backend,
+		&asset.Checksum,
+		&asset.OriginalFilename,
+		&asset.ContentType,
+	)
+	return asset, err
+}
+
+// ErrStorageQuotaExceeded is returned by CreateAssetWithinQuota when the
+// asset would take its owner over their quota.
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+func (c Client) CreateAsset(params CreateAssetParams) (Asset, error) {
+	return c.CreateAssetWithinQuota(params, 0)
+}
+
+// CreateAssetWithinQuota records an asset unless it would take the size of
+// everything its owner stores over quota bytes. The check and the insert share
+// a transaction, so concurrent uploads can't both squeeze in under the quota.
+// A quota of zero means unlimited.
+func (c Client) CreateAssetWithinQuota(params CreateAssetParams, quota int64) (Asset, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Asset{}, err
+	}
+	defer tx.Rollback()
+
+	// Concurrent uploads by the same user must not both pass the check.
+	// SQLite only lets one transaction write at a time, and the insert comes
+	// before the check. Postgres lets them run side by side, and under READ
+	// COMMITTED neither would see the other's row, so lock the user first.
+	if quota > 0 && c.dialect == dialectPostgres {
+		var locked uuid.UUID
+		err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", params.UserID).Scan(&locked)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Asset{}, err
+		}
+	}
+	id := uuid.New()
+	query := `
+	INSERT INTO assets (
+		id,
+		created_at,
+		user_id,
+		video_id,
+		category,
+		storage_key,
+		size,
+		backend,
+		checksum,
+		original_filename,
+		content_type
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(
+		query,
+		id,
+		params.UserID,
+		params.VideoID,
+		params.Category,
+		params.StorageKey,
+		params.Size,
+		params.Backend,
+		params.Checksum,
+		params.OriginalFilename,
+		params.ContentType,
+	)
+	if err != nil {
+		return Asset{}, err
+	}
+
+	if quota > 0 {
+		var total int64
+		err := tx.QueryRow("SELECT COALESCE(SUM(size), 0) FROM assets WHERE user_id = ?", params.UserID).Scan(&total)
+		if err != nil {
+			return Asset{}, err
+		}
+		if total > quota {
+			return Asset{}, ErrStorageQuotaExceeded
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Asset{}, err
+	}
+	return c.GetAsset(id)
+}
+
+func (c Client) GetAsset(id uuid.UUID) (Asset, error) {
+	query := `
+	SELECT` + assetColumns + `
+	WHERE id = ?
+	`
+
+	asset, err := scanAsset(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Asset{}, nil
+		}
+		return Asset{}, err
+	}
+
+	return asset, nil
+}
+
+// GetAssetByKey finds the asset stored under key on a backend.
+func (c Client) GetAssetByKey(backend, key string) (Asset, error) {
+	query := `
+	SELECT` + assetColumns + `
+	WHERE backend = ? AND storage_key = ?
+	`
+
+	asset, err := scanAsset(c.db.QueryRow(query, backend, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Asset{}, nil
+		}
+		return Asset{}, err
+	}
+	return asset, nil
+}
+
+// CountAssetsWithKey counts the assets other than exclude that are stored
+// under key on a backend.
+func (c Client) CountAssetsWithKey(backend, key string, exclude uuid.UUID) (int, error) {
+	query := `
+	SELECT COUNT(*) FROM assets
+	WHERE backend = ? AND storage_key = ? AND id != ?
+	`
+
+	var count int
+	err := c.db.QueryRow(query, backend, key, exclude).Scan(&count)
+	return count, err
+}
+
+func (c Client) GetVideoAssets(videoID uuid.UUID) ([]Asset, error) {
+	query := `
+	SELECT` + assetColumns + `
+	WHERE video_id = ?
+	ORDER BY created_at DESC
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []Asset{}
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, rows.Err()
+}
+
+func (c Client) DeleteAsset(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM asset_health WHERE asset_id = ?", id); err != nil {
+		return err
+	}
+
+	query := `
+	DELETE FROM assets
+	WHERE id = ?
+	`
+	if _, err := tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetStorageUsage sums the size of every asset a user owns, grouped by
+// category. Categories without any assets are reported as zero.
+func (c Client) GetStorageUsage(userID uuid.UUID) (StorageUsage, error) {
+	query := `
+	SELECT category, COALESCE(SUM(size), 0)
+	FROM assets
+	WHERE user_id = ?
+	GROUP BY category
+	`
+
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+	defer rows.Close()
+
+	usage := StorageUsage{
+		Categories: make(map[AssetCategory]int64, len(AssetCategories)),
+	}
+	for _, category := range AssetCategories {
+		usage.Categories[category] = 0
+	}
+	for rows.Next() {
+		var category AssetCategory
+		var size int64
+		if err := rows.Scan(&category, &size); err != nil {
+			return StorageUsage{}, err
+		}
+		usage.Categories[category] = size
+		usage.TotalBytes += size
+	}
+
+	return usage, rows.Err()
+}
+
+// GetAssetsPage returns up to limit assets with an ID greater than after,
+// ordered by ID, so callers can walk every asset in batches.
+func (c Client) GetAssetsPage(after uuid.UUID, limit int) ([]Asset, error) {
+	query := `
+	SELECT` + assetColumns + `
+	WHERE id > ?
+	ORDER BY id
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []Asset{}
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, rows.Err()
+}
+
+// GetAssetsOnBackend works like GetAssetsPage but only returns assets stored
+// on the given backend.
+func (c Client) GetAssetsOnBackend(backend string, after uuid.UUID, limit int) ([]Asset, error) {
+	query := `
+	SELECT` + assetColumns + `
+	WHERE backend = ? AND id > ?
+	ORDER BY id
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, backend, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []Asset{}
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, rows.Err()
+}
+
+// SetDefaultAssetBackend records the backend for assets of a category that
+// were stored before assets tracked their backend.
+func (c Client) SetDefaultAssetBackend(category AssetCategory, backend string) error {
+	query := `
+	UPDATE assets
+	SET backend = ?
+	WHERE backend = '' AND category = ?
+	`
+	_, err := c.db.Exec(query, backend, category)
+	return err
+}
+
+type AssetMove struct {
+	AssetID    uuid.UUID
+	Backend    string
+	StorageKey string
+	Checksum   string
+	OldURL     string
+	NewURL     string
+	// VideoID limits the URL rewrite to the asset's own video, for when other
+	// videos share its old location and stay there. Nil rewrites every video.
+	VideoID uuid.UUID
+}
+
+// MoveAssets points assets at a new backend and key, records their verified
+// checksum and rewrites the video URLs that referenced their old location,
+// all in one transaction.
+func (c Client) MoveAssets(moves []AssetMove) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, move := range moves {
+		query := `
+		UPDATE assets
+		SET backend = ?, storage_key = ?, checksum = ?
+		WHERE id = ?
+		`
+		if _, err := tx.Exec(query, move.Backend, move.StorageKey, move.Checksum, move.AssetID); err != nil {
+			return err
+		}
+		if move.OldURL == move.NewURL {
+			continue
+		}
+		videoCondition, args := "", []any{move.NewURL, move.OldURL}
+		if move.VideoID != uuid.Nil {
+			videoCondition, args = " AND id = ?", append(args, move.VideoID)
+		}
+		touch := ", updated_at = " + c.dialect.later("updated_at") + ", revision = revision + 1"
+		if _, err := tx.Exec("UPDATE videos SET thumbnail_url = ?"+touch+" WHERE thumbnail_url = ?"+videoCondition, args...); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE videos SET video_url = ?"+touch+" WHERE video_url = ?"+videoCondition, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
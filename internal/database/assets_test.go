@@ -0,0 +1,308 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAssets(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		create := func(category AssetCategory, backend, key string, size int64) Asset {
+			t.Helper()
+			asset, err := c.CreateAsset(CreateAssetParams{
+				UserID:           user.ID,
+				VideoID:          video.ID,
+				Category:         category,
+				StorageKey:       key,
+				Size:             size,
+				Backend:          backend,
+				Checksum:         "sum-" + key,
+				OriginalFilename: "upload-" + key,
+				ContentType:      "video/mp4",
+			})
+			if err != nil {
+				t.Fatalf("CreateAsset: %v", err)
+			}
+			return asset
+		}
+		original := create(AssetCategoryVideo, "local", "a.mp4", 100)
+		copied := create(AssetCategoryVideo, "local", "a.mp4", 100)
+		thumbnail := create(AssetCategoryThumbnail, "s3:bucket", "a.png", 10)
+		legacy := create(AssetCategoryThumbnail, "", "old.png", 1)
+
+		got, err := c.GetAsset(original.ID)
+		if err != nil || got.StorageKey != "a.mp4" || got.Checksum != "sum-a.mp4" || got.OriginalFilename != "upload-a.mp4" || got.Size != 100 {
+			t.Errorf("GetAsset = %+v, %v", got, err)
+		}
+		if got, err := c.GetAsset(uuid.New()); err != nil || got.ID != uuid.Nil {
+			t.Errorf("GetAsset of a missing asset = %+v, %v", got, err)
+		}
+		if got, err := c.GetAssetByKey("s3:bucket", "a.png"); err != nil || got.ID != thumbnail.ID {
+			t.Errorf("GetAssetByKey = %+v, %v", got, err)
+		}
+		if n, err := c.CountAssetsWithKey("local", "a.mp4", original.ID); err != nil || n != 1 {
+			t.Errorf("CountAssetsWithKey = %d, %v", n, err)
+		}
+		if got, err := c.GetVideoAssets(video.ID); err != nil || len(got) != 4 {
+			t.Errorf("GetVideoAssets = %d assets, %v", len(got), err)
+		}
+
+		usage, err := c.GetStorageUsage(user.ID)
+		if err != nil {
+			t.Fatalf("GetStorageUsage: %v", err)
+		}
+		if usage.TotalBytes != 211 || usage.Categories[AssetCategoryVideo] != 200 || usage.Categories[AssetCategoryThumbnail] != 11 || usage.Categories[AssetCategoryRendition] != 0 {
+			t.Errorf("GetStorageUsage = %+v", usage)
+		}
+
+		seen := 0
+		for after := uuid.Nil; ; {
+			page, err := c.GetAssetsPage(after, 3)
+			if err != nil {
+				t.Fatalf("GetAssetsPage: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			seen += len(page)
+			after = page[len(page)-1].ID
+		}
+		if seen != 4 {
+			t.Errorf("paging through assets saw %d", seen)
+		}
+		if got, err := c.GetAssetsOnBackend("local", uuid.Nil, 10); err != nil || len(got) != 2 {
+			t.Errorf("GetAssetsOnBackend = %d assets, %v", len(got), err)
+		}
+
+		if err := c.SetDefaultAssetBackend(AssetCategoryThumbnail, "local"); err != nil {
+			t.Fatalf("SetDefaultAssetBackend: %v", err)
+		}
+		if got, _ := c.GetAsset(legacy.ID); got.Backend != "local" {
+			t.Errorf("asset without a backend is on %q", got.Backend)
+		}
+		if got, _ := c.GetAsset(thumbnail.ID); got.Backend != "s3:bucket" {
+			t.Errorf("SetDefaultAssetBackend moved an asset that had a backend to %q", got.Backend)
+		}
+
+		oldURL, newURL := "http://localhost/assets/a.png", "https://cdn.example.com/a.png"
+		video.ThumbnailURL = &oldURL
+		if err := c.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := c.GetVideo(video.ID)
+		err = c.MoveAssets([]AssetMove{{AssetID: thumbnail.ID, Backend: "s3:other", StorageKey: "moved.png", Checksum: "verified", OldURL: oldURL, NewURL: newURL}})
+		if err != nil {
+			t.Fatalf("MoveAssets: %v", err)
+		}
+		if got, _ := c.GetAsset(thumbnail.ID); got.Backend != "s3:other" || got.StorageKey != "moved.png" || got.Checksum != "verified" {
+			t.Errorf("moved asset = %+v", got)
+		}
+		moved, _ := c.GetVideo(video.ID)
+		if moved.ThumbnailURL == nil || *moved.ThumbnailURL != newURL {
+			t.Errorf("thumbnail URL after MoveAssets = %v", moved.ThumbnailURL)
+		}
+		if moved.Revision != before.Revision+1 || !moved.UpdatedAt.After(before.UpdatedAt) {
+			t.Error("MoveAssets didn't bump the video's revision and updated_at")
+		}
+
+		if err := c.SetAssetHealth(AssetHealth{AssetID: original.ID, Status: AssetHealthOK, CheckedAt: time.Now()}); err != nil {
+			t.Fatalf("SetAssetHealth: %v", err)
+		}
+		if err := c.DeleteAsset(original.ID); err != nil {
+			t.Fatalf("DeleteAsset of a checked asset: %v", err)
+		}
+		if got, _ := c.GetAsset(original.ID); got.ID != uuid.Nil {
+			t.Error("asset is still there after DeleteAsset")
+		}
+		if n, _ := c.CountAssetsWithKey("local", "a.mp4", uuid.Nil); n != 1 || copied.ID == uuid.Nil {
+			t.Errorf("%d assets left with the deleted one's key, want 1", n)
+		}
+	})
+}
+
+func TestCreateAssetWithinQuota(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		params := func(size int64) CreateAssetParams {
+			return CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: uuid.NewString(), Size: size}
+		}
+
+		tests := []struct {
+			name  string
+			size  int64
+			quota int64
+			want  error
+		}{
+			{"unlimited", 1000, 0, nil},
+			{"under the quota", 10, 1100, nil},
+			{"up to the quota", 90, 1100, nil},
+			{"over the quota", 1, 1100, ErrStorageQuotaExceeded},
+			{"bigger than the quota", 2000, 1000, ErrStorageQuotaExceeded},
+		}
+		for _, tt := range tests {
+			_, err := c.CreateAssetWithinQuota(params(tt.size), tt.quota)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: CreateAssetWithinQuota = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		usage, _ := c.GetStorageUsage(user.ID)
+		if usage.TotalBytes != 1100 {
+			t.Errorf("usage is %d bytes, want 1100; assets over the quota were recorded", usage.TotalBytes)
+		}
+	})
+}
+
+func TestCreateAssetWithinQuotaConcurrently(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+
+		const uploads, size, quota = 10, 10, 45
+		var wg sync.WaitGroup
+		errs := make(chan error, uploads)
+		for i := 0; i < uploads; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.CreateAssetWithinQuota(CreateAssetParams{
+					UserID:     user.ID,
+					VideoID:    video.ID,
+					Category:   AssetCategoryVideo,
+					StorageKey: uuid.NewString(),
+					Size:       size,
+				}, quota)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, ErrStorageQuotaExceeded):
+				t.Errorf("CreateAssetWithinQuota: %v", err)
+			}
+		}
+		if created != quota/size {
+			t.Errorf("%d uploads fit, want %d", created, quota/size)
+		}
+		if usage, _ := c.GetStorageUsage(user.ID); usage.TotalBytes > quota {
+			t.Errorf("usage is %d bytes, over the quota of %d", usage.TotalBytes, quota)
+		}
+	})
+}
+
+func TestVideoVersions(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		if got, err := c.GetCurrentVideoVersion(video.ID); err != nil || got.ID != uuid.Nil {
+			t.Errorf("GetCurrentVideoVersion without versions = %+v, %v", got, err)
+		}
+
+		var versions []VideoVersion
+		for i := 0; i < 3; i++ {
+			asset, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: uuid.NewString(), Size: 5, Backend: "local"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := c.CreateVideoVersion(CreateVideoVersionParams{
+				VideoID:         video.ID,
+				AssetID:         asset.ID,
+				SHA256:          asset.StorageKey,
+				Width:           1920,
+				Height:          1080,
+				DurationSeconds: 12.5,
+				AspectRatio:     "16:9",
+				UploadedBy:      user.ID,
+			})
+			if err != nil {
+				t.Fatalf("CreateVideoVersion: %v", err)
+			}
+			if version.Version != i+1 || !version.Current || version.StorageKey != asset.StorageKey || version.Size != 5 || version.DurationSeconds != 12.5 {
+				t.Errorf("CreateVideoVersion returned %+v", version)
+			}
+			versions = append(versions, version)
+		}
+
+		list, err := c.GetVideoVersions(video.ID)
+		if err != nil || len(list) != 3 || list[0].Version != 3 || !list[0].Current || list[1].Current || list[2].Current {
+			t.Fatalf("GetVideoVersions = %+v, %v", list, err)
+		}
+
+		if err := c.SetCurrentVideoVersion(video.ID, versions[0].ID); err != nil {
+			t.Fatalf("SetCurrentVideoVersion: %v", err)
+		}
+		current, err := c.GetCurrentVideoVersion(video.ID)
+		if err != nil || current.ID != versions[0].ID {
+			t.Errorf("GetCurrentVideoVersion = %+v, %v", current, err)
+		}
+		if got, _ := c.GetVideoVersion(versions[2].ID); got.Current {
+			t.Error("the previous current version is still current")
+		}
+
+		if err := c.DeleteVideoVersion(versions[1].ID); err != nil {
+			t.Fatalf("DeleteVideoVersion: %v", err)
+		}
+		if got, _ := c.GetVideoVersion(versions[1].ID); got.ID != uuid.Nil {
+			t.Error("version is still there after DeleteVideoVersion")
+		}
+		next, err := c.CreateVideoVersion(CreateVideoVersionParams{VideoID: video.ID, AssetID: versions[1].AssetID, UploadedBy: user.ID})
+		if err != nil || next.Version != 4 {
+			t.Errorf("version after deleting one = %d, %v; want 4", next.Version, err)
+		}
+	})
+}
+
+func TestAssetHealthReport(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		var assets []Asset
+		for i := 0; i < 4; i++ {
+			asset, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: uuid.NewString(), Size: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assets = append(assets, asset)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		checks := []AssetHealth{
+			{AssetID: assets[0].ID, Status: AssetHealthMissing, Detail: "gone", CheckedAt: now.Add(-time.Hour)},
+			{AssetID: assets[1].ID, Status: AssetHealthOK, CheckedAt: now},
+			{AssetID: assets[2].ID, Status: AssetHealthSizeMismatch, Detail: "0 bytes", CheckedAt: now},
+			// A later check replaces the earlier one.
+			{AssetID: assets[0].ID, Status: AssetHealthChecksumMismatch, Detail: "different", CheckedAt: now.Add(-time.Minute)},
+		}
+		for _, check := range checks {
+			if err := c.SetAssetHealth(check); err != nil {
+				t.Fatalf("SetAssetHealth: %v", err)
+			}
+		}
+
+		report, err := c.GetAssetHealthReport()
+		if err != nil {
+			t.Fatalf("GetAssetHealthReport: %v", err)
+		}
+		if report.Unchecked != 1 || report.Counts[AssetHealthOK] != 1 || report.Counts[AssetHealthSizeMismatch] != 1 || report.Counts[AssetHealthChecksumMismatch] != 1 || report.Counts[AssetHealthMissing] != 0 {
+			t.Errorf("report counts = %+v, unchecked %d", report.Counts, report.Unchecked)
+		}
+		if len(report.Problems) != 2 || report.Problems[0].ID != assets[2].ID || report.Problems[1].ID != assets[0].ID {
+			t.Fatalf("report problems = %+v", report.Problems)
+		}
+		if p := report.Problems[1]; p.Status != AssetHealthChecksumMismatch || p.Detail != "different" || !p.CheckedAt.Equal(now.Add(-time.Minute)) {
+			t.Errorf("problem = %+v", p)
+		}
+	})
+}
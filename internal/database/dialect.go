@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite3"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDSN picks the database from the scheme of a DSN. postgres:// and
+// postgresql:// URLs connect to Postgres; anything else is a SQLite file,
+// optionally prefixed with sqlite:// or sqlite3://.
+func parseDSN(dsn string) (dialect, string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		// Timestamps are stored without a time zone, so sessions use UTC
+		// like SQLite's CURRENT_TIMESTAMP does.
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", "", err
+		}
+		q := u.Query()
+		if !q.Has("timezone") {
+			q.Set("timezone", "UTC")
+			u.RawQuery = q.Encode()
+		}
+		return dialectPostgres, u.String(), nil
+	}
+	for _, scheme := range []string{"sqlite3://", "sqlite://"} {
+		if path, ok := strings.CutPrefix(dsn, scheme); ok {
+			return dialectSQLite, path, nil
+		}
+	}
+	return dialectSQLite, dsn, nil
+}
+
+// now is an SQL expression for the current time. SQLite's CURRENT_TIMESTAMP
+// only has whole seconds, so it's spelled out with milliseconds there.
+func (d dialect) now() string {
+	if d == dialectPostgres {
+		return "CURRENT_TIMESTAMP"
+	}
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+// later is an SQL expression for the current time, or for just after the
+// column's current value if the clock hasn't moved past it yet. Setting a
+// timestamp to it changes the timestamp on every write, even when two writes
+// land within the clock's resolution.
+func (d dialect) later(column string) string {
+	if d == dialectPostgres {
+		return "GREATEST(LOCALTIMESTAMP, " + column + " + INTERVAL '1 microsecond')"
+	}
+	return "MAX(" + d.now() + ", COALESCE(strftime('%Y-%m-%d %H:%M:%f', " + column + ", '+0.001 seconds'), ''))"
+}
+
+// rebind rewrites the ? placeholders queries are written with into the
+// $1, $2, ... form Postgres expects. Question marks inside quoted strings are
+// left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// bindArgs converts times to UTC, since Postgres drops the offset when storing
+// them in a TIMESTAMP column.
+func (d dialect) bindArgs(args []any) []any {
+	if d != dialectPostgres {
+		return args
+	}
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.UTC()
+		}
+	}
+	return args
+}
+
+// conn runs queries written for SQLite against either database by rebinding
+// their placeholders.
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), c.dialect.bindArgs(args)...)
+}
+
+func (c conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), c.dialect.bindArgs(args)...)
+}
+
+func (c conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), c.dialect.bindArgs(args)...)
+}
+
+func (c conn) Begin() (tx, error) {
+	t, err := c.DB.Begin()
+	if err != nil {
+		return tx{}, err
+	}
+	return tx{Tx: t, dialect: c.dialect}, nil
+}
+
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), t.dialect.bindArgs(args)...)
+}
+
+func (t tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.rebind(query), t.dialect.bindArgs(args)...)
+}
+
+func (t tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), t.dialect.bindArgs(args)...)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{"sqlite is left alone", dialectSQLite, "SELECT * FROM videos WHERE id = ? AND user_id = ?", "SELECT * FROM videos WHERE id = ? AND user_id = ?"},
+		{"no placeholders", dialectPostgres, "SELECT 1", "SELECT 1"},
+		{"numbered in order", dialectPostgres, "UPDATE videos SET title = ? WHERE id = ? AND revision = ?", "UPDATE videos SET title = $1 WHERE id = $2 AND revision = $3"},
+		{"quoted question marks", dialectPostgres, "SELECT '?', 'a?b' FROM videos WHERE id = ?", "SELECT '?', 'a?b' FROM videos WHERE id = $1"},
+		{"escaped quotes", dialectPostgres, "SELECT 'it''s?' WHERE a = ? AND b = ''", "SELECT 'it''s?' WHERE a = $1 AND b = ''"},
+		{"many placeholders", dialectPostgres, "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindArgs(t *testing.T) {
+	local := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	args := dialectPostgres.bindArgs([]any{local, "x"})
+	if got := args[0].(time.Time); got.Location() != time.UTC || !got.Equal(local) {
+		t.Errorf("Postgres time argument = %v, want %v in UTC", got, local)
+	}
+	if args[1] != "x" {
+		t.Errorf("Postgres string argument = %v", args[1])
+	}
+
+	args = dialectSQLite.bindArgs([]any{local})
+	if got := args[0].(time.Time); got.Location() == time.UTC {
+		t.Errorf("SQLite time argument was converted to UTC")
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn         string
+		wantDialect dialect
+		wantSource  string
+	}{
+		{"tubely.db", dialectSQLite, "tubely.db"},
+		{"/var/lib/tubely/tubely.db", dialectSQLite, "/var/lib/tubely/tubely.db"},
+		{"sqlite://tubely.db", dialectSQLite, "tubely.db"},
+		{"sqlite3:///tmp/tubely.db", dialectSQLite, "/tmp/tubely.db"},
+		{"postgres://u:p@localhost/tubely", dialectPostgres, "postgres://u:p@localhost/tubely?timezone=UTC"},
+		{"postgresql://localhost/tubely?sslmode=disable", dialectPostgres, "postgresql://localhost/tubely?sslmode=disable&timezone=UTC"},
+		{"postgres://localhost/tubely?timezone=Europe%2FMadrid", dialectPostgres, "postgres://localhost/tubely?timezone=Europe%2FMadrid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			d, source, err := parseDSN(tt.dsn)
+			if err != nil {
+				t.Fatalf("parseDSN: %v", err)
+			}
+			if d != tt.wantDialect || source != tt.wantSource {
+				t.Errorf("parseDSN(%q) = %s, %q, want %s, %q", tt.dsn, d, source, tt.wantDialect, tt.wantSource)
+			}
+		})
+	}
+}
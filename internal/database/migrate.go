@@ -0,0 +1,274 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each dialect has its own directory of migrations named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// migrationHooks holds data changes that can't be written in SQL, keyed by
+// the version of the migration whose up script they finish. They run in the
+// same transaction, after the script.
+var migrationHooks = map[int]func(t tx) error{
+	9: hashRefreshTokens,
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func (d dialect) migrationDir() string {
+	if d == dialectPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// loadMigrations returns the migrations for a dialect in version order.
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := d.migrationDir()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		versionString, title, ok2 := strings.Cut(base, "_")
+		if !ok || !ok2 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+		version, err := strconv.Atoi(versionString)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected migration file %s: %w", name, err)
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (c Client) ensureMigrationsTable() error {
+	_, err := c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)
+	`)
+	return err
+}
+
+func (c Client) appliedMigrations() (map[int]time.Time, error) {
+	rows, err := c.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every migration that hasn't been applied yet, each in its
+// own transaction.
+func (c Client) Migrate() error {
+	if err := c.ensureMigrationsTable(); err != nil {
+		return err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		if err := c.upgradeLegacySchema(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := c.runMigration(m.up, func(t tx) error {
+			if hook, ok := migrationHooks[m.Version]; ok {
+				if err := hook(t); err != nil {
+					return err
+				}
+			}
+			_, err := t.Exec(
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now().UTC(),
+			)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// RollbackMigrations undoes up to steps of the most recently applied
+// migrations, newest first, and returns how many it undid.
+func (c Client) RollbackMigrations(steps int) (int, error) {
+	if err := c.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	rolledBack := 0
+	for i := len(migrations) - 1; i >= 0 && rolledBack < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.down == "" {
+			return rolledBack, fmt.Errorf("migration %d_%s can't be rolled back", m.Version, m.Name)
+		}
+		err := c.runMigration(m.down, func(t tx) error {
+			_, err := t.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("rolling back migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+// GetMigrationStatus lists every known migration and when it was applied.
+func (c Client) GetMigrationStatus() ([]MigrationStatus, error) {
+	if err := c.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (c Client) runMigration(script string, record func(t tx) error) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if _, err := t.Exec(script); err != nil {
+		return err
+	}
+	if err := record(t); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// upgradeLegacySchema adds the asset columns that were added to existing
+// databases at startup before migrations existed, so the first migration
+// finds tables in the shape it creates them in.
+func (c Client) upgradeLegacySchema() error {
+	exists, err := c.tableExists("assets")
+	if err != nil || !exists {
+		return err
+	}
+	for _, column := range []string{"backend", "checksum", "original_filename", "content_type"} {
+		if err := c.addColumnIfMissing("assets", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Client) tableExists(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if c.dialect == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var count int
+	err := c.db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	sqlite, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		t.Fatalf("loading SQLite migrations: %v", err)
+	}
+	postgres, err := loadMigrations(dialectPostgres)
+	if err != nil {
+		t.Fatalf("loading Postgres migrations: %v", err)
+	}
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("%d SQLite migrations, %d Postgres migrations", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		s, p := sqlite[i], postgres[i]
+		if s.Version != i+1 || s.Version != p.Version || s.Name != p.Name {
+			t.Errorf("migration %d is %d_%s on SQLite and %d_%s on Postgres", i+1, s.Version, s.Name, p.Version, p.Name)
+		}
+		if s.down == "" || p.down == "" {
+			t.Errorf("migration %d_%s has no down script", s.Version, s.Name)
+		}
+	}
+}
+
+// seedTestData puts a row in most tables, so down and up scripts are run
+// against data and not just empty tables.
+func seedTestData(t *testing.T, c Client) {
+	t.Helper()
+	user := createTestUser(t, c)
+	video := createTestVideo(t, c, user.ID, "cats")
+	asset, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: "a.mp4", Size: 10, Backend: "local"})
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	if _, err := c.CreateVideoVersion(CreateVideoVersionParams{VideoID: video.ID, AssetID: asset.ID, SHA256: "abc", UploadedBy: user.ID}); err != nil {
+		t.Fatalf("CreateVideoVersion: %v", err)
+	}
+	if _, err := c.AddVideoTag(user.ID, video.ID, "pets"); err != nil {
+		t.Fatalf("AddVideoTag: %v", err)
+	}
+	if err := c.SetAssetHealth(AssetHealth{AssetID: asset.ID, Status: AssetHealthOK, CheckedAt: time.Now()}); err != nil {
+		t.Fatalf("SetAssetHealth: %v", err)
+	}
+	if _, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if _, err := c.CreateAPIKey(CreateAPIKeyParams{UserID: user.ID, Name: "ci", Key: uuid.NewString(), Scopes: []string{"videos:read"}}); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := c.TakeDownVideo(video.ID, "spam"); err != nil {
+		t.Fatalf("TakeDownVideo: %v", err)
+	}
+}
+
+func appliedCount(t *testing.T, c Client) int {
+	t.Helper()
+	statuses, err := c.GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	applied := 0
+	for i, status := range statuses {
+		if status.AppliedAt == nil {
+			continue
+		}
+		if i != applied {
+			t.Fatalf("migration %d is applied but one before it isn't", status.Version)
+		}
+		applied++
+	}
+	return applied
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	forEachEmptyDialect(t, func(t *testing.T, c Client) {
+		migrations, err := loadMigrations(c.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := len(migrations)
+
+		if err := c.Migrate(); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if got := appliedCount(t, c); got != total {
+			t.Fatalf("%d of %d migrations applied", got, total)
+		}
+		if err := c.Migrate(); err != nil {
+			t.Fatalf("Migrate on an up to date database: %v", err)
+		}
+		seedTestData(t, c)
+
+		// Roll back ever more migrations and apply them again, so each down
+		// script runs against the schema and data the up scripts leave.
+		for steps := 1; steps <= total; steps++ {
+			n, err := c.RollbackMigrations(steps)
+			if err != nil {
+				t.Fatalf("rolling back %d migrations: %v", steps, err)
+			}
+			if n != steps {
+				t.Fatalf("rolled back %d migrations, want %d", n, steps)
+			}
+			if got := appliedCount(t, c); got != total-steps {
+				t.Fatalf("after rolling back %d migrations %d are applied, want %d", steps, got, total-steps)
+			}
+			if err := c.Migrate(); err != nil {
+				t.Fatalf("migrating up after rolling back %d: %v", steps, err)
+			}
+			if got := appliedCount(t, c); got != total {
+				t.Fatalf("after migrating up %d of %d migrations are applied", got, total)
+			}
+		}
+
+		if n, err := c.RollbackMigrations(total + 1); err != nil || n != total {
+			t.Fatalf("RollbackMigrations(all) = %d, %v", n, err)
+		}
+		for _, table := range []string{"users", "videos", "assets", "refresh_tokens", "api_keys", "tags"} {
+			exists, err := c.tableExists(table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists {
+				t.Errorf("table %s is left after rolling back every migration", table)
+			}
+		}
+	})
+}
+
+func TestMigrateHashesRefreshTokens(t *testing.T) {
+	forEachEmptyDialect(t, func(t *testing.T, c Client) {
+		if err := c.Migrate(); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		migrations, err := loadMigrations(c.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.RollbackMigrations(len(migrations) - 8); err != nil {
+			t.Fatalf("rolling back to migration 8: %v", err)
+		}
+
+		userID := uuid.New()
+		token := "0123456789abcdef"
+		if _, err := c.db.Exec("INSERT INTO users (id, email, password) VALUES (?, ?, ?)", userID.String(), "a@example.com", "hash"); err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.db.Exec(
+			"INSERT INTO refresh_tokens (token, user_id, expires_at, family_id) VALUES (?, ?, ?, ?)",
+			token, userID.String(), time.Now().Add(time.Hour).UTC(), token,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Migrate(); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		rt, err := c.GetRefreshToken(token)
+		if err != nil {
+			t.Fatalf("GetRefreshToken: %v", err)
+		}
+		if rt.UserID != userID {
+			t.Fatalf("token stored before hashing doesn't work after migrating")
+		}
+		if rt.FamilyID != hashToken(token) {
+			t.Errorf("family named after the token is %q, want its hash", rt.FamilyID)
+		}
+		var stored int
+		if err := c.db.QueryRow("SELECT COUNT(*) FROM refresh_tokens WHERE token_hash = ?", token).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored != 0 {
+			t.Error("token is still stored in the clear")
+		}
+	})
+}
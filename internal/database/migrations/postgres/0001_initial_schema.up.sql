@@ -0,0 +1,75 @@
+-- The schema as it was created before migrations existed. Every statement
+-- is skipped for tables that already exist.
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS assets (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	category TEXT NOT NULL,
+	storage_key TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	backend TEXT NOT NULL DEFAULT '',
+	checksum TEXT NOT NULL DEFAULT '',
+	original_filename TEXT NOT NULL DEFAULT '',
+	content_type TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_assets_user_id ON assets(user_id);
+CREATE INDEX IF NOT EXISTS idx_assets_video_id ON assets(video_id);
+
+CREATE TABLE IF NOT EXISTS asset_health (
+	asset_id TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	detail TEXT NOT NULL DEFAULT '',
+	checked_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(asset_id) REFERENCES assets(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_versions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	is_current BOOLEAN NOT NULL DEFAULT FALSE,
+	asset_id TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	width INTEGER NOT NULL DEFAULT 0,
+	height INTEGER NOT NULL DEFAULT 0,
+	duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+	aspect_ratio TEXT NOT NULL DEFAULT '',
+	uploaded_by TEXT NOT NULL,
+	UNIQUE(video_id, version),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(asset_id) REFERENCES assets(id),
+	FOREIGN KEY(uploaded_by) REFERENCES users(id)
+);
@@ -0,0 +1 @@
+-- user_id holds UUIDs, so it can't go back to an integer type.
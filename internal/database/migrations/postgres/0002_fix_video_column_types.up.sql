@@ -0,0 +1,4 @@
+-- Postgres databases never had the SQLite column types; this only makes sure
+-- the columns are TEXT.
+ALTER TABLE videos ALTER COLUMN video_url TYPE TEXT;
+ALTER TABLE videos ALTER COLUMN user_id TYPE TEXT;
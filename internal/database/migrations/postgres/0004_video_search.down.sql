@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_search;
+DROP TRIGGER IF EXISTS videos_search_update ON videos;
+DROP FUNCTION IF EXISTS videos_search_update();
+ALTER TABLE videos DROP COLUMN IF EXISTS search;
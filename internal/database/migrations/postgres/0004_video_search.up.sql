@@ -0,0 +1,20 @@
+ALTER TABLE videos ADD COLUMN search tsvector;
+
+CREATE FUNCTION videos_search_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search :=
+		setweight(to_tsvector('simple', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(NEW.description, '')), 'B');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER videos_search_update
+BEFORE INSERT OR UPDATE OF title, description ON videos
+FOR EACH ROW EXECUTE FUNCTION videos_search_update();
+
+UPDATE videos SET search =
+	setweight(to_tsvector('simple', COALESCE(title, '')), 'A') ||
+	setweight(to_tsvector('simple', COALESCE(description, '')), 'B');
+
+CREATE INDEX idx_videos_search ON videos USING GIN (search);
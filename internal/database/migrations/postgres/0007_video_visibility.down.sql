@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_videos_user_visibility;
+ALTER TABLE videos DROP COLUMN visibility;
@@ -0,0 +1,3 @@
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private'
+	CHECK (visibility IN ('private', 'unlisted', 'public'));
+CREATE INDEX idx_videos_user_visibility ON videos(user_id, visibility);
@@ -0,0 +1,6 @@
+-- Every refresh token belongs to the family started by a login. Refreshing
+-- replaces a token with a new one in the same family.
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by TEXT;
+UPDATE refresh_tokens SET family_id = token;
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
@@ -0,0 +1,6 @@
+-- Tokens can't be recovered from their hashes, so every session ends and
+-- users have to log in again.
+DELETE FROM refresh_tokens;
+DROP INDEX IF EXISTS idx_refresh_tokens_prefix;
+ALTER TABLE refresh_tokens DROP COLUMN token_prefix;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,8 @@
+-- Refresh tokens are stored as their SHA-256, plus a short prefix of the token
+-- to look them up by. The existing tokens are hashed by the Go step of this
+-- migration.
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE refresh_tokens ADD COLUMN token_prefix TEXT NOT NULL DEFAULT '';
+UPDATE refresh_tokens SET token_prefix = substr(token_hash, 1, 8);
+ALTER TABLE refresh_tokens ALTER COLUMN token_prefix DROP DEFAULT;
+CREATE INDEX idx_refresh_tokens_prefix ON refresh_tokens(token_prefix);
@@ -0,0 +1,5 @@
+-- The client a refresh token was issued to, so users can tell their logins
+-- apart.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id, revoked_at);
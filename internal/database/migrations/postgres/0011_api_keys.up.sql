@@ -0,0 +1,17 @@
+-- Personal API keys. Like refresh tokens, only a hash of the key is stored,
+-- and the first characters are kept to find it by.
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	key_hash TEXT UNIQUE NOT NULL,
+	key_prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_api_keys_prefix ON api_keys(key_prefix);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
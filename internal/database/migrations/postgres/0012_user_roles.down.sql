@@ -0,0 +1,4 @@
+ALTER TABLE videos DROP COLUMN takedown_reason;
+ALTER TABLE videos DROP COLUMN taken_down_at;
+ALTER TABLE users DROP COLUMN disabled_at;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,9 @@
+-- What a user is allowed to do beyond managing their own videos. Moderators
+-- can take videos down; admins can also manage users.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'moderator', 'admin'));
+-- Disabled users can't log in, and their sessions and API keys stop working.
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
+-- Taken down videos are kept private, and only a moderator can lift it.
+ALTER TABLE videos ADD COLUMN taken_down_at TIMESTAMP;
+ALTER TABLE videos ADD COLUMN takedown_reason TEXT;
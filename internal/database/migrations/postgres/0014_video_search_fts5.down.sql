@@ -0,0 +1 @@
+-- Search on Postgres already ranks and highlights in SQL; see 0004.
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS video_versions;
+DROP TABLE IF EXISTS asset_health;
+DROP TABLE IF EXISTS assets;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_video_versions_current;
+DROP INDEX IF EXISTS idx_videos_user_title;
+DROP INDEX IF EXISTS idx_videos_user_updated;
+DROP INDEX IF EXISTS idx_videos_user_created;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_videos_user_created ON videos(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_videos_user_updated ON videos(user_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_videos_user_title ON videos(user_id, title, id);
+CREATE INDEX IF NOT EXISTS idx_video_versions_current ON video_versions(video_id, is_current);
@@ -0,0 +1,28 @@
+-- FTS5 isn't compiled into the default go-sqlite3 build, so the index uses
+-- FTS4. Rows are matched to videos by video_id rather than rowid, which
+-- VACUUM may renumber.
+CREATE VIRTUAL TABLE videos_fts USING fts4(
+	video_id,
+	title,
+	description,
+	notindexed=video_id,
+	tokenize=unicode61
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
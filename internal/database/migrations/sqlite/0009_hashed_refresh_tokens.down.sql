@@ -0,0 +1,17 @@
+-- Tokens can't be recovered from their hashes, so every session ends and
+-- users have to log in again.
+CREATE TABLE refresh_tokens_old (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT,
+	replaced_by TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
@@ -0,0 +1,24 @@
+-- Refresh tokens are stored as their SHA-256, plus a short prefix of the token
+-- to look them up by. The tokens are copied over as they are and hashed by
+-- the Go step of this migration.
+CREATE TABLE refresh_tokens_new (
+	token_hash TEXT PRIMARY KEY,
+	token_prefix TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	family_id TEXT,
+	replaced_by TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO refresh_tokens_new (token_hash, token_prefix, created_at, updated_at, revoked_at, user_id, expires_at, family_id, replaced_by)
+SELECT token, substr(token, 1, 8), created_at, updated_at, revoked_at, user_id, expires_at, family_id, replaced_by
+FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_prefix ON refresh_tokens(token_prefix);
@@ -0,0 +1,4 @@
+-- Counts the writes to a video's row. UpdateVideoIfUnchanged only applies an
+-- update while the row is still at the revision it was read at, so two writers
+-- can't overwrite each other's changes. The ETag is derived from updated_at.
+ALTER TABLE videos ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
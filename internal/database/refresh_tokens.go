@@ -1,36 +1,61 @@
 package database
 
 import (
-	"database/sql"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenUsed is returned when rotating a refresh token that was
+// already revoked or replaced.
+var ErrRefreshTokenUsed = errors.New("refresh token was already used")
+
 type RefreshToken struct {
 	CreateRefreshTokenParams
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
+	// ReplacedBy is the hash of the token this one was rotated into, if it
+	// was.
+	ReplacedBy *string `json:"-"`
 }
 
 type CreateRefreshTokenParams struct {
 	Token     string    `json:"token"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyID groups a login's refresh token with the ones it is rotated
+	// into. A new family is started when it is empty.
+	FamilyID string `json:"-"`
+	// UserAgent and IPAddress describe the client the token was issued to.
+	UserAgent string `json:"-"`
+	IPAddress string `json:"-"`
+}
+
+// tokenPrefixLength is how many characters of a token are stored in the
+// clear to find its row by.
+const tokenPrefixLength = 8
+
+// hashToken is what's stored in place of a refresh token or API key, so the
+// database alone can't be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenPrefix(token string) string {
+	return token[:min(len(token), tokenPrefixLength)]
 }
 
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
-	query := `
-		INSERT INTO refresh_tokens (
-			token,
-			created_at,
-			updated_at,
-			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
-	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	if params.FamilyID == "" {
+		params.FamilyID = uuid.NewString()
+	}
+	_, err := c.db.Exec(insertRefreshTokenQuery, refreshTokenArgs(params)...)
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -38,46 +63,162 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 	return c.GetRefreshToken(params.Token)
 }
 
+const insertRefreshTokenQuery = `
+	INSERT INTO refresh_tokens (
+		token_hash,
+		token_prefix,
+		created_at,
+		updated_at,
+		user_id,
+		expires_at,
+		family_id,
+		user_agent,
+		ip_address
+	) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+`
+
+func refreshTokenArgs(params CreateRefreshTokenParams) []any {
+	return []any{
+		hashToken(params.Token),
+		tokenPrefix(params.Token),
+		params.UserID.String(),
+		params.ExpiresAt,
+		params.FamilyID,
+		params.UserAgent,
+		params.IPAddress,
+	}
+}
+
+// RotateRefreshToken revokes a refresh token and replaces it with a new one
+// in the same family. If the old token was already revoked, for example by a
+// concurrent rotation, it returns ErrRefreshTokenUsed and creates nothing.
+func (c Client) RotateRefreshToken(old string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer t.Rollback()
+
+	result, err := t.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, replaced_by = ?
+		WHERE token_hash = ? AND revoked_at IS NULL
+	`, hashToken(params.Token), hashToken(old))
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if rows != 1 {
+		return RefreshToken{}, ErrRefreshTokenUsed
+	}
+
+	_, err = t.Exec(insertRefreshTokenQuery, refreshTokenArgs(params)...)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(params.Token)
+}
+
 func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked_at = CURRENT_TIMESTAMP
-		WHERE token = ?
+		WHERE token_hash = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.db.Exec(query, hashToken(token))
 	return err
 }
 
+// RevokeRefreshTokenFamily revokes every token of a family that is still
+// valid, ending the login it came from.
+func (c Client) RevokeRefreshTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, familyID)
+	return err
+}
+
+// GetRefreshToken looks a token up by its prefix and checks it against the
+// stored hashes in constant time. It returns a zero RefreshToken if there is
+// no match.
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip_address
 		FROM refresh_tokens
-		WHERE token = ?
+		WHERE token_prefix = ?
 	`
-	var rt RefreshToken
-	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	rows, err := c.db.Query(query, tokenPrefix(token))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
-		}
 		return RefreshToken{}, err
 	}
+	defer rows.Close()
 
-	rt.UserID, err = uuid.Parse(userID)
-	if err != nil {
-		return RefreshToken{}, err
+	hash := hashToken(token)
+	for rows.Next() {
+		var rt RefreshToken
+		var storedHash, userID string
+		err := rows.Scan(&storedHash, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt, &rt.FamilyID, &rt.ReplacedBy, &rt.UserAgent, &rt.IPAddress)
+		if err != nil {
+			return RefreshToken{}, err
+		}
+		if subtle.ConstantTimeCompare([]byte(storedHash), []byte(hash)) != 1 {
+			continue
+		}
+
+		rt.Token = token
+		rt.UserID, err = uuid.Parse(userID)
+		if err != nil {
+			return RefreshToken{}, err
+		}
+		return rt, nil
 	}
 
-	return rt, nil
+	return RefreshToken{}, rows.Err()
 }
 
-func (c Client) DeleteRefreshToken(token string) error {
-	query := `
-		DELETE FROM refresh_tokens
-		WHERE token = ?
-	`
-	_, err := c.db.Exec(query, token)
-	return err
+// hashRefreshTokens replaces the tokens stored before they were hashed with
+// their hashes. It runs as part of migration 9.
+func hashRefreshTokens(t tx) error {
+	rows, err := t.Query("SELECT token_hash FROM refresh_tokens")
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		hash := hashToken(token)
+		if _, err := t.Exec("UPDATE refresh_tokens SET token_hash = ? WHERE token_hash = ?", hash, token); err != nil {
+			return err
+		}
+		if _, err := t.Exec("UPDATE refresh_tokens SET replaced_by = ? WHERE replaced_by = ?", hash, token); err != nil {
+			return err
+		}
+		// Families started before migration 8 are named after their first token.
+		if _, err := t.Exec("UPDATE refresh_tokens SET family_id = ? WHERE family_id = ?", hash, token); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGetRefreshToken(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		token := uuid.NewString()
+		// Tokens are found by their prefix, so give another one the same.
+		twin := token[:tokenPrefixLength] + uuid.NewString()
+		for _, tok := range []string{token, twin} {
+			if _, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: tok, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+		}
+
+		tests := []struct {
+			name  string
+			token string
+			found bool
+		}{
+			{"token", token, true},
+			{"token with the same prefix", twin, true},
+			{"same prefix, wrong token", token[:tokenPrefixLength] + "wrong", false},
+			{"unknown", uuid.NewString(), false},
+			{"empty", "", false},
+		}
+		for _, tt := range tests {
+			rt, err := c.GetRefreshToken(tt.token)
+			if err != nil {
+				t.Fatalf("%s: GetRefreshToken: %v", tt.name, err)
+			}
+			if found := rt.Token != ""; found != tt.found || (found && (rt.Token != tt.token || rt.UserID != user.ID)) {
+				t.Errorf("%s: GetRefreshToken = %+v, want found %v", tt.name, rt, tt.found)
+			}
+		}
+	})
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		expires := time.Now().Add(time.Hour)
+		login := func() RefreshToken {
+			t.Helper()
+			rt, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: expires})
+			if err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+			return rt
+		}
+		rotate := func(old RefreshToken) (RefreshToken, error) {
+			return c.RotateRefreshToken(old.Token, CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: expires, FamilyID: old.FamilyID})
+		}
+
+		first := login()
+		if first.FamilyID == "" || first.RevokedAt != nil || first.ReplacedBy != nil {
+			t.Fatalf("CreateRefreshToken returned %+v", first)
+		}
+		second, err := rotate(first)
+		if err != nil {
+			t.Fatalf("RotateRefreshToken: %v", err)
+		}
+		if second.FamilyID != first.FamilyID || second.RevokedAt != nil {
+			t.Errorf("rotated token = %+v", second)
+		}
+		old, _ := c.GetRefreshToken(first.Token)
+		if old.RevokedAt == nil || old.ReplacedBy == nil || *old.ReplacedBy != hashToken(second.Token) {
+			t.Errorf("token after rotating it = %+v, want it revoked and replaced", old)
+		}
+
+		revoked := login()
+		if err := c.RevokeRefreshToken(revoked.Token); err != nil {
+			t.Fatalf("RevokeRefreshToken: %v", err)
+		}
+
+		tests := []struct {
+			name string
+			old  RefreshToken
+		}{
+			{"rotated", first},
+			{"revoked", revoked},
+			{"unknown", RefreshToken{CreateRefreshTokenParams: CreateRefreshTokenParams{Token: uuid.NewString()}}},
+		}
+		for _, tt := range tests {
+			next, err := rotate(tt.old)
+			if !errors.Is(err, ErrRefreshTokenUsed) {
+				t.Errorf("%s: RotateRefreshToken = %v, want ErrRefreshTokenUsed", tt.name, err)
+			}
+			if next.Token != "" {
+				t.Errorf("%s: RotateRefreshToken returned a token", tt.name)
+			}
+		}
+
+		other := login()
+		if err := c.RevokeRefreshTokenFamily(first.FamilyID); err != nil {
+			t.Fatalf("RevokeRefreshTokenFamily: %v", err)
+		}
+		if got, _ := c.GetRefreshToken(second.Token); got.RevokedAt == nil {
+			t.Error("the family's current token isn't revoked")
+		}
+		if got, _ := c.GetRefreshToken(other.Token); got.RevokedAt != nil {
+			t.Error("RevokeRefreshTokenFamily revoked another login's token")
+		}
+	})
+}
+
+func TestRotateRefreshTokenConcurrently(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		expires := time.Now().Add(time.Hour)
+		old, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: expires})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const rotations = 8
+		var wg sync.WaitGroup
+		errs := make(chan error, rotations)
+		for i := 0; i < rotations; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.RotateRefreshToken(old.Token, CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: expires, FamilyID: old.FamilyID})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		rotated := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				rotated++
+			case !errors.Is(err, ErrRefreshTokenUsed):
+				t.Errorf("RotateRefreshToken: %v", err)
+			}
+		}
+		if rotated != 1 {
+			t.Errorf("token was rotated %d times, want once", rotated)
+		}
+		if sessions, _ := c.GetSessions(user.ID); len(sessions) != 1 {
+			t.Errorf("%d sessions after racing rotations, want 1", len(sessions))
+		}
+	})
+}
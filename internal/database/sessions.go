@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login: the family of refresh tokens that started with it. Its
+// ID is the family ID, and it lasts until its current token is revoked or
+// expires.
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// GetSessions lists a user's active sessions, most recently used first. A
+// session was created with the first token of its family, the one no other
+// token was rotated into, and last used when its current token was issued.
+func (c Client) GetSessions(userID uuid.UUID) ([]Session, error) {
+	query := `
+	SELECT
+		rt.family_id,
+		first.created_at,
+		rt.created_at,
+		rt.expires_at,
+		rt.user_agent,
+		rt.ip_address
+	FROM refresh_tokens rt
+	JOIN refresh_tokens first ON first.family_id = rt.family_id
+		AND NOT EXISTS (SELECT 1 FROM refresh_tokens p WHERE p.replaced_by = first.token_hash)
+	WHERE rt.user_id = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?
+	ORDER BY rt.created_at DESC
+	`
+
+	rows, err := c.db.Query(query, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IPAddress,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// IsSessionActive reports whether a session belongs to the user and still has
+// a refresh token that can be used.
+func (c Client) IsSessionActive(userID uuid.UUID, sessionID string) (bool, error) {
+	query := `
+	SELECT COUNT(*) FROM refresh_tokens
+	WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	`
+
+	var count int
+	err := c.db.QueryRow(query, sessionID, userID.String(), time.Now().UTC()).Scan(&count)
+	return count > 0, err
+}
+
+// RevokeUserSessions ends every session of a user.
+func (c Client) RevokeUserSessions(userID uuid.UUID) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID.String())
+	return err
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessions(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		other := createTestUser(t, c)
+		expires := time.Now().Add(time.Hour)
+		create := func(userID uuid.UUID, agent string, expiresAt time.Time) RefreshToken {
+			t.Helper()
+			rt, err := c.CreateRefreshToken(CreateRefreshTokenParams{Token: uuid.NewString(), UserID: userID, ExpiresAt: expiresAt, UserAgent: agent, IPAddress: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+			return rt
+		}
+
+		laptop := create(user.ID, "laptop", expires)
+		phone := create(user.ID, "phone", expires)
+		expired := create(user.ID, "old", time.Now().Add(-time.Hour))
+		create(other.ID, "theirs", expires)
+
+		rotated, err := c.RotateRefreshToken(laptop.Token, CreateRefreshTokenParams{Token: uuid.NewString(), UserID: user.ID, ExpiresAt: expires, FamilyID: laptop.FamilyID, UserAgent: "laptop 2", IPAddress: "10.0.0.1"})
+		if err != nil {
+			t.Fatalf("RotateRefreshToken: %v", err)
+		}
+
+		sessions, err := c.GetSessions(user.ID)
+		if err != nil {
+			t.Fatalf("GetSessions: %v", err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("GetSessions = %+v, want the laptop and phone sessions", sessions)
+		}
+		byID := map[string]Session{}
+		for _, s := range sessions {
+			byID[s.ID] = s
+		}
+		s, ok := byID[laptop.FamilyID]
+		if !ok || s.UserAgent != "laptop 2" || s.IPAddress != "10.0.0.1" || !s.CreatedAt.Equal(laptop.CreatedAt) || !s.LastUsedAt.Equal(rotated.CreatedAt) {
+			t.Errorf("rotated session = %+v", s)
+		}
+		if _, ok := byID[phone.FamilyID]; !ok {
+			t.Error("phone session is missing")
+		}
+
+		tests := []struct {
+			name    string
+			userID  uuid.UUID
+			session string
+			want    bool
+		}{
+			{"active", user.ID, phone.FamilyID, true},
+			{"rotated", user.ID, laptop.FamilyID, true},
+			{"expired", user.ID, expired.FamilyID, false},
+			{"someone else's", other.ID, phone.FamilyID, false},
+			{"unknown", user.ID, uuid.NewString(), false},
+		}
+		for _, tt := range tests {
+			if got, err := c.IsSessionActive(tt.userID, tt.session); err != nil || got != tt.want {
+				t.Errorf("%s: IsSessionActive = %v, %v; want %v", tt.name, got, err, tt.want)
+			}
+		}
+
+		if err := c.RevokeUserSessions(user.ID); err != nil {
+			t.Fatalf("RevokeUserSessions: %v", err)
+		}
+		if sessions, _ := c.GetSessions(user.ID); len(sessions) != 0 {
+			t.Errorf("sessions left after RevokeUserSessions: %+v", sessions)
+		}
+		if sessions, _ := c.GetSessions(other.ID); len(sessions) != 1 {
+			t.Error("RevokeUserSessions ended another user's session")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store is everything the server reads from and writes to its database.
+// Client implements it for both SQLite and Postgres.
+type Store interface {
+	Reset() error
+
+	GetUsers() ([]User, error)
+	GetUser(id uuid.UUID) (*User, error)
+	GetUserByEmail(email string) (User, error)
+	CreateUser(params CreateUserParams) (*User, error)
+	SetUserRole(id uuid.UUID, role Role) error
+	SetUserDisabled(id uuid.UUID, disabled bool) error
+	DeleteUser(id uuid.UUID) error
+
+	CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(token string) (RefreshToken, error)
+	RotateRefreshToken(old string, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	RevokeRefreshTokenFamily(familyID string) error
+
+	GetSessions(userID uuid.UUID) ([]Session, error)
+	IsSessionActive(userID uuid.UUID, sessionID string) (bool, error)
+	RevokeUserSessions(userID uuid.UUID) error
+
+	CreateAPIKey(params CreateAPIKeyParams) (APIKey, error)
+	GetAPIKey(key string) (APIKey, error)
+	GetAPIKeyByID(id uuid.UUID) (APIKey, error)
+	GetAPIKeys(userID uuid.UUID) ([]APIKey, error)
+	RevokeAPIKey(id uuid.UUID) error
+	TouchAPIKey(id uuid.UUID) error
+
+	ListVideos(params ListVideosParams) (VideoPage, error)
+	SearchVideos(params SearchVideosParams) (VideoSearchPage, error)
+	GetVideosPage(after uuid.UUID, limit int) ([]Video, error)
+	GetVideo(id uuid.UUID) (Video, error)
+	GetTrashedVideo(id uuid.UUID) (Video, error)
+	GetVideosTrashedBefore(before time.Time, limit int) ([]Video, error)
+	GetVideosWithAsset(backend, key string) ([]Video, error)
+	CreateVideo(params CreateVideoParams) (Video, error)
+	UpdateVideoIfUnchanged(video Video) error
+	SetVideoURL(id uuid.UUID, url string) error
+	SetVideoThumbnailURL(id uuid.UUID, url string) error
+	TrashVideo(id uuid.UUID) error
+	RestoreVideo(id uuid.UUID) error
+	TakeDownVideo(id uuid.UUID, reason string) error
+	ReinstateVideo(id uuid.UUID) error
+	DeleteVideo(id uuid.UUID) error
+
+	AddVideoTag(userID, videoID uuid.UUID, name string) (Tag, error)
+	RemoveVideoTag(userID, videoID uuid.UUID, name string) error
+	GetVideoTags(videoID uuid.UUID) ([]Tag, error)
+	GetUserTags(userID uuid.UUID) ([]TagCount, error)
+
+	CreateVideoVersion(params CreateVideoVersionParams) (VideoVersion, error)
+	GetVideoVersion(id uuid.UUID) (VideoVersion, error)
+	GetCurrentVideoVersion(videoID uuid.UUID) (VideoVersion, error)
+	GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error)
+	SetCurrentVideoVersion(videoID, versionID uuid.UUID) error
+	DeleteVideoVersion(id uuid.UUID) error
+
+	CreateAsset(params CreateAssetParams) (Asset, error)
+	CreateAssetWithinQuota(params CreateAssetParams, quota int64) (Asset, error)
+	GetAsset(id uuid.UUID) (Asset, error)
+	GetAssetByKey(backend, key string) (Asset, error)
+	CountAssetsWithKey(backend, key string, exclude uuid.UUID) (int, error)
+	GetVideoAssets(videoID uuid.UUID) ([]Asset, error)
+	GetAssetsPage(after uuid.UUID, limit int) ([]Asset, error)
+	GetAssetsOnBackend(backend string, after uuid.UUID, limit int) ([]Asset, error)
+	GetStorageUsage(userID uuid.UUID) (StorageUsage, error)
+	SetDefaultAssetBackend(category AssetCategory, backend string) error
+	MoveAssets(moves []AssetMove) error
+	DeleteAsset(id uuid.UUID) error
+
+	SetAssetHealth(health AssetHealth) error
+	GetAssetHealthReport() (AssetHealthReport, error)
+}
+
+var _ Store = Client{}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tags belong to a user and are shared between that user's videos.
+type Tag struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+}
+
+type TagCount struct {
+	Name   string `json:"name"`
+	Videos int    `json:"videos"`
+}
+
+// AddVideoTag tags a video, creating the tag for the user if they don't have
+// it yet. Adding a tag the video already has is a no-op.
+func (c Client) AddVideoTag(userID, videoID uuid.UUID, name string) (Tag, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return Tag{}, err
+	}
+	defer t.Rollback()
+
+	_, err = t.Exec(`
+	INSERT INTO tags (id, created_at, user_id, name)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT(user_id, name) DO NOTHING
+	`, uuid.New(), userID, name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	var tag Tag
+	err = t.QueryRow(`
+	SELECT id, created_at, user_id, name
+	FROM tags
+	WHERE user_id = ? AND name = ?
+	`, userID, name).Scan(&tag.ID, &tag.CreatedAt, &tag.UserID, &tag.Name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	_, err = t.Exec(`
+	INSERT INTO video_tags (video_id, tag_id, created_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, tag_id) DO NOTHING
+	`, videoID, tag.ID)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	return tag, t.Commit()
+}
+
+// RemoveVideoTag removes a tag from a video. Tags no video uses anymore are
+// deleted.
+func (c Client) RemoveVideoTag(userID, videoID uuid.UUID, name string) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	var tagID uuid.UUID
+	err = t.QueryRow("SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&tagID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.Exec("DELETE FROM video_tags WHERE video_id = ? AND tag_id = ?", videoID, tagID); err != nil {
+		return err
+	}
+	_, err = t.Exec(`
+	DELETE FROM tags
+	WHERE id = ? AND NOT EXISTS (SELECT 1 FROM video_tags WHERE tag_id = ?)
+	`, tagID, tagID)
+	if err != nil {
+		return err
+	}
+
+	return t.Commit()
+}
+
+// GetVideoTags returns a video's tags ordered by name.
+func (c Client) GetVideoTags(videoID uuid.UUID) ([]Tag, error) {
+	query := `
+	SELECT t.id, t.created_at, t.user_id, t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id = ?
+	ORDER BY t.name
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.CreatedAt, &tag.UserID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetUserTags lists a user's tags with how many videos outside the trash use
+// each, ordered by name.
+func (c Client) GetUserTags(userID uuid.UUID) ([]TagCount, error) {
+	query := `
+	SELECT t.name, COUNT(vt.video_id)
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	JOIN videos v ON v.id = vt.video_id AND v.deleted_at IS NULL
+	WHERE t.user_id = ?
+	GROUP BY t.id, t.name
+	ORDER BY t.name
+	`
+
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var count TagCount
+		if err := rows.Scan(&count.Name, &count.Videos); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
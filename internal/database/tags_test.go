@@ -0,0 +1,78 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		other := createTestUser(t, c)
+		cats := createTestVideo(t, c, user.ID, "cats")
+		dogs := createTestVideo(t, c, user.ID, "dogs")
+
+		pets, err := c.AddVideoTag(user.ID, cats.ID, "pets")
+		if err != nil {
+			t.Fatalf("AddVideoTag: %v", err)
+		}
+		again, err := c.AddVideoTag(user.ID, cats.ID, "pets")
+		if err != nil || again.ID != pets.ID {
+			t.Errorf("adding a tag again = %+v, %v; want the same tag", again, err)
+		}
+		if shared, _ := c.AddVideoTag(user.ID, dogs.ID, "pets"); shared.ID != pets.ID {
+			t.Error("a user's videos don't share their tags")
+		}
+		if _, err := c.AddVideoTag(user.ID, cats.ID, "funny"); err != nil {
+			t.Fatal(err)
+		}
+		if theirs, _ := c.AddVideoTag(other.ID, createTestVideo(t, c, other.ID, "birds").ID, "pets"); theirs.ID == pets.ID {
+			t.Error("users share tags")
+		}
+
+		tags, err := c.GetVideoTags(cats.ID)
+		if err != nil || len(tags) != 2 || tags[0].Name != "funny" || tags[1].Name != "pets" {
+			t.Errorf("GetVideoTags = %+v, %v", tags, err)
+		}
+
+		counts, err := c.GetUserTags(user.ID)
+		if err != nil || len(counts) != 2 || counts[0] != (TagCount{"funny", 1}) || counts[1] != (TagCount{"pets", 2}) {
+			t.Errorf("GetUserTags = %+v, %v", counts, err)
+		}
+		if err := c.TrashVideo(dogs.ID); err != nil {
+			t.Fatal(err)
+		}
+		if counts, _ := c.GetUserTags(user.ID); len(counts) != 2 || counts[1] != (TagCount{"pets", 1}) {
+			t.Errorf("GetUserTags counts trashed videos: %+v", counts)
+		}
+
+		if err := c.RemoveVideoTag(user.ID, cats.ID, "funny"); err != nil {
+			t.Fatalf("RemoveVideoTag: %v", err)
+		}
+		if err := c.RemoveVideoTag(user.ID, cats.ID, "unknown"); err != nil {
+			t.Errorf("removing an unknown tag: %v", err)
+		}
+		if err := c.RemoveVideoTag(user.ID, cats.ID, "pets"); err != nil {
+			t.Fatal(err)
+		}
+		if tags, _ := c.GetVideoTags(cats.ID); len(tags) != 0 {
+			t.Errorf("tags left after removing them all: %+v", tags)
+		}
+
+		var left []string
+		rows, err := c.db.Query("SELECT name FROM tags WHERE user_id = ?", user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			left = append(left, name)
+		}
+		if len(left) != 1 || left[0] != "pets" {
+			t.Errorf("tags left are %v, want only the one a video still uses", left)
+		}
+	})
+}
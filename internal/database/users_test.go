@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role, other Role
+		want        bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleUser, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{Role("root"), RoleUser, false},
+		{Role(""), RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.other); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user, err := c.CreateUser(CreateUserParams{Email: "a@example.com", Password: "hash"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if user.Email != "a@example.com" || user.Password != "hash" || user.Role != RoleUser || user.DisabledAt != nil {
+			t.Errorf("CreateUser returned %+v", user)
+		}
+		if _, err := c.CreateUser(CreateUserParams{Email: "a@example.com", Password: "hash"}); err == nil {
+			t.Error("CreateUser accepted a duplicate email")
+		}
+		admin, err := c.CreateUser(CreateUserParams{Email: "b@example.com", Password: "hash", Role: RoleAdmin})
+		if err != nil || admin.Role != RoleAdmin {
+			t.Fatalf("CreateUser with a role = %+v, %v", admin, err)
+		}
+
+		got, err := c.GetUser(user.ID)
+		if err != nil || got == nil || got.Email != user.Email {
+			t.Errorf("GetUser = %+v, %v", got, err)
+		}
+		if got, err := c.GetUser(uuid.New()); err != nil || got != nil {
+			t.Errorf("GetUser of a missing user = %+v, %v", got, err)
+		}
+		if got, err := c.GetUserByEmail("a@example.com"); err != nil || got.ID != user.ID {
+			t.Errorf("GetUserByEmail = %+v, %v", got, err)
+		}
+		if got, err := c.GetUserByEmail("missing@example.com"); err != nil || got.ID != uuid.Nil {
+			t.Errorf("GetUserByEmail of a missing user = %+v, %v", got, err)
+		}
+
+		users, err := c.GetUsers()
+		if err != nil || len(users) != 2 {
+			t.Fatalf("GetUsers = %d users, %v", len(users), err)
+		}
+
+		if err := c.SetUserRole(user.ID, RoleModerator); err != nil {
+			t.Fatalf("SetUserRole: %v", err)
+		}
+		if err := c.SetUserRole(user.ID, Role("root")); err == nil {
+			t.Error("SetUserRole accepted an unknown role")
+		}
+		if got, _ := c.GetUser(user.ID); got.Role != RoleModerator {
+			t.Errorf("role after SetUserRole = %q", got.Role)
+		}
+
+		if err := c.SetUserDisabled(user.ID, true); err != nil {
+			t.Fatalf("SetUserDisabled(true): %v", err)
+		}
+		disabled, _ := c.GetUser(user.ID)
+		if disabled.DisabledAt == nil {
+			t.Fatal("user isn't disabled")
+		}
+		if err := c.SetUserDisabled(user.ID, true); err != nil {
+			t.Fatalf("disabling again: %v", err)
+		}
+		if again, _ := c.GetUser(user.ID); !again.DisabledAt.Equal(*disabled.DisabledAt) {
+			t.Error("disabling again moved disabled_at")
+		}
+		if err := c.SetUserDisabled(user.ID, false); err != nil {
+			t.Fatalf("SetUserDisabled(false): %v", err)
+		}
+		if got, _ := c.GetUser(user.ID); got.DisabledAt != nil {
+			t.Error("user is still disabled")
+		}
+
+		if err := c.DeleteUser(admin.ID); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		if got, _ := c.GetUser(admin.ID); got != nil {
+			t.Error("user is still there after DeleteUser")
+		}
+	})
+}
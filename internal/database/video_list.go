@@ -0,0 +1,236 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortUpdated  VideoSort = "updated"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+// videoSortColumns maps each sort to the expression rows are ordered by and
+// the expression its cursor value is read from. Timestamps are read back as
+// text so a cursor compares equal to the stored value in both dialects.
+var videoSortColumns = map[VideoSort]struct{ order, cursor string }{
+	VideoSortCreated:  {"v.created_at", "CAST(v.created_at AS TEXT)"},
+	VideoSortUpdated:  {"v.updated_at", "CAST(v.updated_at AS TEXT)"},
+	VideoSortTitle:    {"v.title", "v.title"},
+	VideoSortDuration: {"COALESCE(vv.duration_seconds, 0)", "COALESCE(vv.duration_seconds, 0)"},
+}
+
+type VideoOrientation string
+
+const (
+	VideoOrientationLandscape VideoOrientation = "landscape"
+	VideoOrientationPortrait  VideoOrientation = "portrait"
+	VideoOrientationOther     VideoOrientation = "other"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type ListVideosParams struct {
+	UserID    uuid.UUID
+	Sort      VideoSort
+	Ascending bool
+	Limit     int
+	// Cursor is the NextCursor of the previous page, or empty for the first.
+	Cursor string
+
+	HasVideo      *bool
+	Orientation   VideoOrientation
+	Visibility    VideoVisibility
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Tags only keeps videos that have every one of these tags.
+	Tags []string
+	// Trashed lists the videos in the trash instead of the others.
+	Trashed bool
+	// HideTakenDown leaves out videos a moderator has taken down, for lists
+	// shown to other users.
+	HideTakenDown bool
+}
+
+type VideoPage struct {
+	Videos     []Video `json:"videos"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type videoCursor struct {
+	Sort      VideoSort `json:"s"`
+	Ascending bool      `json:"a"`
+	Value     any       `json:"v"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func encodeVideoCursor(cursor videoCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(s string) (videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	var cursor videoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// ListVideos returns a page of a user's videos. Pages are keyed on the sort
+// value and ID of the last video, so videos added or removed between requests
+// don't shift the pages that follow.
+func (c Client) ListVideos(params ListVideosParams) (VideoPage, error) {
+	sort, ok := videoSortColumns[params.Sort]
+	if !ok {
+		return VideoPage{}, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	direction, op := "DESC", "<"
+	if params.Ascending {
+		direction, op = "ASC", ">"
+	}
+
+	where := []string{"v.user_id = ?", "v.deleted_at IS NULL"}
+	if params.Trashed {
+		where[1] = "v.deleted_at IS NOT NULL"
+	}
+	args := []any{true, params.UserID}
+	if params.HasVideo != nil {
+		if *params.HasVideo {
+			where = append(where, "v.video_url IS NOT NULL")
+		} else {
+			where = append(where, "v.video_url IS NULL")
+		}
+	}
+	if params.Visibility != "" {
+		where = append(where, "v.visibility = ?")
+		args = append(args, params.Visibility)
+	}
+	if params.HideTakenDown {
+		where = append(where, "v.taken_down_at IS NULL")
+	}
+	switch params.Orientation {
+	case "":
+	case VideoOrientationLandscape:
+		where = append(where, "vv.aspect_ratio = '16:9'")
+	case VideoOrientationPortrait:
+		where = append(where, "vv.aspect_ratio = '9:16'")
+	case VideoOrientationOther:
+		where = append(where, "vv.aspect_ratio NOT IN ('16:9', '9:16')")
+	default:
+		return VideoPage{}, fmt.Errorf("unknown orientation %q", params.Orientation)
+	}
+	if params.CreatedAfter != nil {
+		where = append(where, "v.created_at >= ?")
+		args = append(args, params.CreatedAfter.UTC().Format(time.DateTime))
+	}
+	if params.CreatedBefore != nil {
+		where = append(where, "v.created_at < ?")
+		args = append(args, params.CreatedBefore.UTC().Format(time.DateTime))
+	}
+	for _, tag := range params.Tags {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM video_tags vt
+			JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.video_id = v.id AND t.name = ?
+		)`)
+		args = append(args, tag)
+	}
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		if cursor.Sort != params.Sort || cursor.Ascending != params.Ascending {
+			return VideoPage{}, fmt.Errorf("%w: it belongs to a different sort order", ErrInvalidCursor)
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND v.id %[2]s ?))", sort.order, op))
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+	args = append(args, params.Limit+1)
+
+	query := fmt.Sprintf(`
+	SELECT
+		v.id,
+		v.created_at,
+		v.updated_at,
+		v.title,
+		v.description,
+		v.thumbnail_url,
+		v.video_url,
+		v.user_id,
+		v.visibility,
+		v.deleted_at,
+		%s
+	FROM videos v
+	LEFT JOIN video_versions vv ON vv.video_id = v.id AND vv.is_current = ?
+	WHERE %s
+	ORDER BY %s %s, v.id %s
+	LIMIT ?
+	`, sort.cursor, strings.Join(where, " AND "), sort.order, direction, direction)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page := VideoPage{Videos: []Video{}}
+	var lastValue any
+	for rows.Next() {
+		var video Video
+		var sortValue any
+		if err := rows.Scan(
+			&video.ID,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+			&video.Title,
+			&video.Description,
+			&video.ThumbnailURL,
+			&video.VideoURL,
+			&video.UserID,
+			&video.Visibility,
+			&video.DeletedAt,
+			&sortValue,
+		); err != nil {
+			return VideoPage{}, err
+		}
+		if b, ok := sortValue.([]byte); ok {
+			sortValue = string(b)
+		}
+		if len(page.Videos) == params.Limit {
+			last := page.Videos[len(page.Videos)-1]
+			page.NextCursor, err = encodeVideoCursor(videoCursor{
+				Sort:      params.Sort,
+				Ascending: params.Ascending,
+				Value:     lastValue,
+				ID:        last.ID,
+			})
+			if err != nil {
+				return VideoPage{}, err
+			}
+			break
+		}
+		page.Videos = append(page.Videos, video)
+		lastValue = sortValue
+	}
+
+	return page, rows.Err()
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	Query  string
+	Limit  int
+	Cursor string
+}
+
+// VideoSearchResult is a video that matched a search. TitleHighlight and
+// DescriptionSnippet are HTML escaped, with matching words wrapped in <mark>.
+type VideoSearchResult struct {
+	Video
+	Rank               float64 `json:"rank"`
+	TitleHighlight     string  `json:"title_highlight"`
+	DescriptionSnippet string  `json:"description_snippet"`
+}
+
+type VideoSearchPage struct {
+	Results    []VideoSearchResult `json:"results"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// searchTerms splits a query into the lowercase words it searches for. Only
+// letters and digits are kept, so user input can't inject query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func encodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeSearchCursor(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// searchVisible limits a search to the videos its user may find: their own,
+// and other users' public videos that haven't been taken down. Unlisted
+// videos are only found by their owner, as they aren't listed anywhere else.
+const searchVisible = "(v.user_id = ? OR (v.visibility = ? AND v.taken_down_at IS NULL))"
+
+// SearchVideos finds the videos a user may see whose title or description
+// contain every word of the query, or a word starting with it, best matches
+// first.
+func (c Client) SearchVideos(params SearchVideosParams) (VideoSearchPage, error) {
+	terms := searchTerms(params.Query)
+	page := VideoSearchPage{Results: []VideoSearchResult{}}
+	if len(terms) == 0 {
+		return page, nil
+	}
+	offset, err := decodeSearchCursor(params.Cursor)
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+
+	var query string
+	var match string
+	if c.dialect == dialectPostgres {
+		query, match = searchVideosPostgres(terms)
+	} else {
+		query, match = searchVideosSQLite(terms)
+	}
+	rows, err := c.db.Query(query, match, params.UserID, VideoPublic, params.Limit+1, offset)
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var r VideoSearchResult
+		if err := rows.Scan(
+			&r.ID,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+			&r.Title,
+			&r.Description,
+			&r.ThumbnailURL,
+			&r.VideoURL,
+			&r.UserID,
+			&r.Visibility,
+			&r.Rank,
+			&r.TitleHighlight,
+			&r.DescriptionSnippet,
+		); err != nil {
+			return VideoSearchPage{}, err
+		}
+		r.TitleHighlight = markMatches(r.TitleHighlight)
+		r.DescriptionSnippet = markMatches(r.DescriptionSnippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoSearchPage{}, err
+	}
+
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+		page.NextCursor = encodeSearchCursor(offset + params.Limit)
+	}
+	page.Results = results
+	return page, nil
+}
+
+// The database wraps matches in these, and markMatches turns them into
+// <mark> tags once the text around them is escaped.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+const snippetWords = 20
+
+func markMatches(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, matchStart, "<mark>")
+	return strings.ReplaceAll(text, matchEnd, "</mark>")
+}
+
+// searchVideosPostgres returns the search query and the tsquery it matches.
+func searchVideosPostgres(terms []string) (string, string) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	marks := fmt.Sprintf("StartSel=%s, StopSel=%s", matchStart, matchEnd)
+	query := `
+	SELECT
+		v.id,
+		v.created_at,
+		v.updated_at,
+		v.title,
+		v.description,
+		v.thumbnail_url,
+		v.video_url,
+		v.user_id,
+		v.visibility,
+		ts_rank(v.search, q) AS rank,
+		ts_headline('simple', v.title, q, '` + marks + `, HighlightAll=true'),
+		ts_headline('simple', COALESCE(v.description, ''), q, '` + marks + fmt.Sprintf(", MaxWords=%d, MinWords=%d", snippetWords, snippetWords/2) + `')
+	FROM videos v, to_tsquery('simple', ?) q
+	WHERE ` + searchVisible + ` AND v.deleted_at IS NULL AND v.search @@ q
+	ORDER BY rank DESC, v.id
+	LIMIT ? OFFSET ?
+	`
+	return query, strings.Join(prefixes, " & ")
+}
+
+// searchVideosSQLite returns the search query and the FTS5 expression it
+// matches. bm25 ranks best matches lowest, so it is negated to sort like
+// ts_rank. Titles weigh four times as much as descriptions.
+func searchVideosSQLite(terms []string) (string, string) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = `"` + term + `"*`
+	}
+	query := `
+	SELECT
+		v.id,
+		v.created_at,
+		v.updated_at,
+		v.title,
+		v.description,
+		v.thumbnail_url,
+		v.video_url,
+		v.user_id,
+		v.visibility,
+		-bm25(videos_fts, 0.0, 4.0, 1.0) AS rank,
+		highlight(videos_fts, 1, '` + matchStart + `', '` + matchEnd + `'),
+		snippet(videos_fts, 2, '` + matchStart + `', '` + matchEnd + `', '…', ` + strconv.Itoa(snippetWords) + `)
+	FROM videos_fts
+	JOIN videos v ON v.id = videos_fts.video_id
+	WHERE videos_fts MATCH ? AND ` + searchVisible + ` AND v.deleted_at IS NULL
+	ORDER BY rank DESC, v.id
+	LIMIT ? OFFSET ?
+	`
+	return query, strings.Join(prefixes, " ")
+}
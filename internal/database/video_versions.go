@@ -0,0 +1,220 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoVersion struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Version    int       `json:"version"`
+	Current    bool      `json:"current"`
+	StorageKey string    `json:"storage_key"`
+	Size       int64     `json:"size"`
+	Backend    string    `json:"backend"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID         uuid.UUID `json:"video_id"`
+	AssetID         uuid.UUID `json:"asset_id"`
+	SHA256          string    `json:"sha256"`
+	Width           int       `json:"width"`
+	Height          int       `json:"height"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	AspectRatio     string    `json:"aspect_ratio"`
+	UploadedBy      uuid.UUID `json:"uploaded_by"`
+}
+
+const videoVersionColumns = `
+		vv.id,
+		vv.created_at,
+		vv.version,
+		vv.is_current,
+		a.storage_key,
+		a.size,
+		a.backend,
+		vv.video_id,
+		vv.asset_id,
+		vv.sha256,
+		vv.width,
+		vv.height,
+		vv.duration_seconds,
+		vv.aspect_ratio,
+		vv.uploaded_by
+	FROM video_versions vv
+	JOIN assets a ON a.id = vv.asset_id
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var version VideoVersion
+	err := row.Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.Version,
+		&version.Current,
+		&version.StorageKey,
+		&version.Size,
+		&version.Backend,
+		&version.VideoID,
+		&version.AssetID,
+		&version.SHA256,
+		&version.Width,
+		&version.Height,
+		&version.DurationSeconds,
+		&version.AspectRatio,
+		&version.UploadedBy,
+	)
+	return version, err
+}
+
+// CreateVideoVersion records a new upload for a video. It is numbered after
+// the latest existing version and becomes the current one.
+func (c Client) CreateVideoVersion(params CreateVideoVersionParams) (VideoVersion, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	defer tx.Rollback()
+
+	var next int
+	err = tx.QueryRow(`
+	SELECT COALESCE(MAX(version), 0) + 1
+	FROM video_versions
+	WHERE video_id = ?
+	`, params.VideoID).Scan(&next)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE video_versions
+	SET is_current = ?
+	WHERE video_id = ?
+	`, false, params.VideoID)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		created_at,
+		video_id,
+		version,
+		is_current,
+		asset_id,
+		sha256,
+		width,
+		height,
+		duration_seconds,
+		aspect_ratio,
+		uploaded_by
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(
+		query,
+		id,
+		params.VideoID,
+		next,
+		true,
+		params.AssetID,
+		params.SHA256,
+		params.Width,
+		params.Height,
+		params.DurationSeconds,
+		params.AspectRatio,
+		params.UploadedBy,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return VideoVersion{}, err
+	}
+
+	return c.GetVideoVersion(id)
+}
+
+func (c Client) GetVideoVersion(id uuid.UUID) (VideoVersion, error) {
+	query := `SELECT` + videoVersionColumns + `WHERE vv.id = ?`
+
+	version, err := scanVideoVersion(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return version, nil
+}
+
+// GetCurrentVideoVersion returns the version a video is currently serving, or
+// a zero VideoVersion if it has none.
+func (c Client) GetCurrentVideoVersion(videoID uuid.UUID) (VideoVersion, error) {
+	query := `SELECT` + videoVersionColumns + `WHERE vv.video_id = ? AND vv.is_current = ?`
+
+	version, err := scanVideoVersion(c.db.QueryRow(query, videoID, true))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return version, nil
+}
+
+// GetVideoVersions returns every recorded upload of a video, newest first.
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `SELECT` + videoVersionColumns + `WHERE vv.video_id = ?
+	ORDER BY vv.version DESC
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		version, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// SetCurrentVideoVersion marks one version of a video as current and clears
+// the flag on all the others.
+func (c Client) SetCurrentVideoVersion(videoID, versionID uuid.UUID) error {
+	query := `
+	UPDATE video_versions
+	SET is_current = (id = ?)
+	WHERE video_id = ?
+	`
+	_, err := c.db.Exec(query, versionID, videoID)
+	return err
+}
+
+func (c Client) DeleteVideoVersion(id uuid.UUID) error {
+	query := `
+	DELETE FROM video_versions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
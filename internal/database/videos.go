@@ -8,22 +8,56 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrVideoChanged is returned by UpdateVideoIfUnchanged when the video was
+// written to after it was read.
+var ErrVideoChanged = errors.New("video was changed since it was read")
+
 type Video struct {
 	ID           uuid.UUID `json:"id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	ThumbnailURL *string   `json:"thumbnail_url"`
 	VideoURL     *string   `json:"video_url"`
+	// DeletedAt is set while the video is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// TakenDownAt is set while a moderator has taken the video down. Only
+	// GetVideo and GetTrashedVideo fill it and TakedownReason in.
+	TakenDownAt    *time.Time `json:"taken_down_at,omitempty"`
+	TakedownReason *string    `json:"takedown_reason,omitempty"`
+	// Revision goes up by one on every write to the video. Only GetVideo and
+	// GetTrashedVideo fill it in.
+	Revision int64 `json:"-"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	UserID      uuid.UUID       `json:"user_id"`
+	Visibility  VideoVisibility `json:"visibility"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+// VideoVisibility controls who besides the owner can see a video.
+type VideoVisibility string
+
+const (
+	// VideoPrivate videos are only visible to their owner.
+	VideoPrivate VideoVisibility = "private"
+	// VideoUnlisted videos are visible to anyone with their ID, but aren't
+	// listed publicly.
+	VideoUnlisted VideoVisibility = "unlisted"
+	// VideoPublic videos are visible to anyone and listed on their owner's
+	// public page.
+	VideoPublic VideoVisibility = "public"
+)
+
+func (v VideoVisibility) Valid() bool {
+	return v == VideoPrivate || v == VideoUnlisted || v == VideoPublic
+}
+
+// GetVideosPage returns up to limit videos of any user with an ID greater
+// than after, ordered by ID.
+func (c Client) GetVideosPage(after uuid.UUID, limit int) ([]Video, error) {
 	query := `
 	SELECT
 		id,
@@ -33,13 +67,15 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		visibility
 	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
+	WHERE id > ?
+	ORDER BY id
+	LIMIT ?
 	`
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.db.Query(query, after, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -57,13 +93,14 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 			&video.ThumbnailURL,
 			&video.VideoURL,
 			&video.UserID,
+			&video.Visibility,
 		); err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
-	return videos, nil
+	return videos, rows.Err()
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
@@ -75,10 +112,14 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		visibility
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VideoPrivate
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID, params.Visibility)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,7 +127,23 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo returns a video that isn't in the trash, or a zero Video if there
+// is none with the ID.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, false)
+}
+
+// GetTrashedVideo returns a video that is in the trash, or a zero Video if
+// there is none with the ID.
+func (c Client) GetTrashedVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, true)
+}
+
+func (c Client) getVideo(id uuid.UUID, trashed bool) (Video, error) {
+	condition := "deleted_at IS NULL"
+	if trashed {
+		condition = "deleted_at IS NOT NULL"
+	}
 	query := `
 	SELECT
 		id,
@@ -96,10 +153,14 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		visibility,
+		deleted_at,
+		taken_down_at,
+		takedown_reason,
+		revision
 	FROM videos
-	WHERE id = ?
-	`
+	WHERE id = ? AND ` + condition
 
 	var video Video
 	err := c.db.QueryRow(query, id).Scan(
@@ -110,7 +171,12 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		&video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
-		&video.UserID)
+		&video.UserID,
+		&video.Visibility,
+		&video.DeletedAt,
+		&video.TakenDownAt,
+		&video.TakedownReason,
+		&video.Revision)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,35 +187,241 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
+// UpdateVideo saves every field of a video and sets its updated_at to now, or
+// to just after its previous value if that was within the same millisecond.
+// It isn't part of Store: the server only saves whole videos through
+// UpdateVideoIfUnchanged, so a stale copy can't overwrite newer changes.
 func (c Client) UpdateVideo(video Video) error {
+	_, err := c.updateVideo(video, "")
+	return err
+}
+
+// UpdateVideoIfUnchanged is UpdateVideo, but only while the video is still
+// at video.Revision. Otherwise it returns ErrVideoChanged and saves nothing.
+func (c Client) UpdateVideoIfUnchanged(video Video) error {
+	res, err := c.updateVideo(video, " AND revision = ?", video.Revision)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVideoChanged
+	}
+	return nil
+}
+
+func (c Client) updateVideo(video Video, condition string, conditionArgs ...any) (sql.Result, error) {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ` + c.dialect.later("updated_at") + `,
+		revision = revision + 1,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
-	WHERE id = ?
-	`
+		user_id = ?,
+		visibility = ?
+	WHERE id = ?` + condition
 
-	_, err := c.db.Exec(
-		query,
+	args := []any{
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.Visibility,
 		video.ID,
-	)
+	}
+	return c.db.Exec(query, append(args, conditionArgs...)...)
+}
+
+// SetVideoURL points a video at a new file. Unlike UpdateVideo it leaves
+// every other field alone, so it is safe to call with a video that was read
+// long before, such as at the start of an upload.
+func (c Client) SetVideoURL(id uuid.UUID, url string) error {
+	return c.setVideoColumn(id, "video_url", url)
+}
+
+// SetVideoThumbnailURL is SetVideoURL for the video's thumbnail.
+func (c Client) SetVideoThumbnailURL(id uuid.UUID, url string) error {
+	return c.setVideoColumn(id, "thumbnail_url", url)
+}
+
+func (c Client) setVideoColumn(id uuid.UUID, column string, value any) error {
+	query := "UPDATE videos SET " + column + " = ?, updated_at = " + c.dialect.later("updated_at") + ", revision = revision + 1 WHERE id = ?"
+	_, err := c.db.Exec(query, value, id)
+	return err
+}
+
+// TrashVideo moves a video to the trash. It stays there, with its files,
+// until it is restored or deleted for good.
+func (c Client) TrashVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("UPDATE videos SET deleted_at = "+c.dialect.now()+", updated_at = "+c.dialect.later("updated_at")+", revision = revision + 1 WHERE id = ? AND deleted_at IS NULL", id)
+	return err
+}
+
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("UPDATE videos SET deleted_at = NULL, updated_at = "+c.dialect.later("updated_at")+", revision = revision + 1 WHERE id = ? AND deleted_at IS NOT NULL", id)
 	return err
 }
 
+// TakeDownVideo hides a video from everyone but its owner until it is
+// reinstated.
+func (c Client) TakeDownVideo(id uuid.UUID, reason string) error {
+	query := `
+	UPDATE videos
+	SET
+		visibility = ?,
+		taken_down_at = ` + c.dialect.now() + `,
+		takedown_reason = ?,
+		updated_at = ` + c.dialect.later("updated_at") + `,
+		revision = revision + 1
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, VideoPrivate, reason, id)
+	return err
+}
+
+// ReinstateVideo lifts a takedown. The video stays private until its owner
+// changes that.
+func (c Client) ReinstateVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("UPDATE videos SET taken_down_at = NULL, takedown_reason = NULL, updated_at = "+c.dialect.later("updated_at")+", revision = revision + 1 WHERE id = ?", id)
+	return err
+}
+
+// GetVideosTrashedBefore returns up to limit videos of any user that were
+// moved to the trash before the given time, oldest first.
+func (c Client) GetVideosTrashedBefore(before time.Time, limit int) ([]Video, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		thumbnail_url,
+		video_url,
+		user_id,
+		visibility,
+		deleted_at
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at < ?
+	ORDER BY deleted_at, id
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, before.UTC().Format(time.DateTime), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		var video Video
+		if err := rows.Scan(
+			&video.ID,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+			&video.Title,
+			&video.Description,
+			&video.ThumbnailURL,
+			&video.VideoURL,
+			&video.UserID,
+			&video.Visibility,
+			&video.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// GetVideosWithAsset returns every video, including trashed ones, that uses
+// the stored object at key on a backend.
+func (c Client) GetVideosWithAsset(backend, key string) ([]Video, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		thumbnail_url,
+		video_url,
+		user_id,
+		visibility,
+		deleted_at
+	FROM videos
+	WHERE id IN (SELECT video_id FROM assets WHERE backend = ? AND storage_key = ?)
+	`
+
+	rows, err := c.db.Query(query, backend, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		var video Video
+		if err := rows.Scan(
+			&video.ID,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+			&video.Title,
+			&video.Description,
+			&video.ThumbnailURL,
+			&video.VideoURL,
+			&video.UserID,
+			&video.Visibility,
+			&video.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// DeleteVideo removes a video for good, whether or not it is in the trash.
+// Its files have to be deleted separately.
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM video_versions WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM video_tags WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	DELETE FROM tags
+	WHERE user_id = (SELECT user_id FROM videos WHERE id = ?)
+	AND NOT EXISTS (SELECT 1 FROM video_tags WHERE tag_id = tags.id)
+	`, id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	if _, err := tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video, err := c.CreateVideo(CreateVideoParams{UserID: user.ID, Title: "cats", Description: "two cats"})
+		if err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+		if video.ID == uuid.Nil || video.Title != "cats" || video.Visibility != VideoPrivate || video.Revision != 1 {
+			t.Errorf("CreateVideo returned %+v", video)
+		}
+		if got, err := c.GetVideo(uuid.New()); err != nil || got.ID != uuid.Nil {
+			t.Errorf("GetVideo of a missing video = %+v, %v", got, err)
+		}
+
+		url := "http://localhost/assets/a.mp4"
+		video.Title = "dogs"
+		video.VideoURL = &url
+		video.Visibility = VideoPublic
+		if err := c.UpdateVideo(video); err != nil {
+			t.Fatalf("UpdateVideo: %v", err)
+		}
+		updated, err := c.GetVideo(video.ID)
+		if err != nil {
+			t.Fatalf("GetVideo: %v", err)
+		}
+		if updated.Title != "dogs" || updated.VideoURL == nil || *updated.VideoURL != url || updated.Visibility != VideoPublic {
+			t.Errorf("video after UpdateVideo = %+v", updated)
+		}
+		if updated.Revision != video.Revision+1 {
+			t.Errorf("revision after UpdateVideo = %d, want %d", updated.Revision, video.Revision+1)
+		}
+		// updated_at moves forward on every write, even within the same
+		// millisecond, so ETags derived from it change too.
+		if err := c.UpdateVideo(updated); err != nil {
+			t.Fatal(err)
+		}
+		again, _ := c.GetVideo(video.ID)
+		if !again.UpdatedAt.After(updated.UpdatedAt) || !updated.UpdatedAt.After(video.UpdatedAt) {
+			t.Errorf("updated_at went %v, %v, %v; want it to increase on every write", video.UpdatedAt, updated.UpdatedAt, again.UpdatedAt)
+		}
+		updated = again
+
+		stale := video
+		updated.Title = "birds"
+		if err := c.UpdateVideoIfUnchanged(updated); err != nil {
+			t.Fatalf("UpdateVideoIfUnchanged at the current revision: %v", err)
+		}
+		stale.Title = "fish"
+		if err := c.UpdateVideoIfUnchanged(stale); !errors.Is(err, ErrVideoChanged) {
+			t.Fatalf("UpdateVideoIfUnchanged at an old revision = %v, want ErrVideoChanged", err)
+		}
+		if got, _ := c.GetVideo(video.ID); got.Title != "birds" {
+			t.Errorf("title = %q, want the one from the conditional update", got.Title)
+		}
+
+		page, err := c.ListVideos(ListVideosParams{UserID: user.ID, Sort: VideoSortCreated, Limit: 10})
+		if err != nil || len(page.Videos) != 1 || page.Videos[0].ID != video.ID {
+			t.Errorf("ListVideos = %+v, %v", page.Videos, err)
+		}
+		if _, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: "a.mp4", Size: 1, Backend: "local"}); err != nil {
+			t.Fatalf("CreateAsset: %v", err)
+		}
+		if got, err := c.GetVideosWithAsset("local", "a.mp4"); err != nil || len(got) != 1 || got[0].ID != video.ID {
+			t.Errorf("GetVideosWithAsset = %+v, %v", got, err)
+		}
+		if got, err := c.GetVideosWithAsset("local", "b.mp4"); err != nil || len(got) != 0 {
+			t.Errorf("GetVideosWithAsset of an unused key = %+v, %v", got, err)
+		}
+	})
+}
+
+func TestVideoTrash(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+
+		if got, _ := c.GetTrashedVideo(video.ID); got.ID != uuid.Nil {
+			t.Error("GetTrashedVideo found a video that isn't in the trash")
+		}
+		before, _ := c.GetVideo(video.ID)
+		if err := c.TrashVideo(video.ID); err != nil {
+			t.Fatalf("TrashVideo: %v", err)
+		}
+		if got, _ := c.GetVideo(video.ID); got.ID != uuid.Nil {
+			t.Error("GetVideo found a video in the trash")
+		}
+		trashed, err := c.GetTrashedVideo(video.ID)
+		if err != nil || trashed.ID != video.ID || trashed.DeletedAt == nil {
+			t.Fatalf("GetTrashedVideo = %+v, %v", trashed, err)
+		}
+		if trashed.Revision != before.Revision+1 || !trashed.UpdatedAt.After(before.UpdatedAt) {
+			t.Error("TrashVideo didn't bump the revision and updated_at")
+		}
+		if page, _ := c.ListVideos(ListVideosParams{UserID: user.ID, Sort: VideoSortCreated, Limit: 10}); len(page.Videos) != 0 {
+			t.Error("ListVideos lists a video in the trash")
+		}
+
+		if got, err := c.GetVideosTrashedBefore(time.Now().Add(-time.Hour), 10); err != nil || len(got) != 0 {
+			t.Errorf("GetVideosTrashedBefore an hour ago = %d videos, %v", len(got), err)
+		}
+		if got, err := c.GetVideosTrashedBefore(time.Now().Add(time.Hour), 10); err != nil || len(got) != 1 {
+			t.Errorf("GetVideosTrashedBefore in an hour = %d videos, %v", len(got), err)
+		}
+
+		if err := c.RestoreVideo(video.ID); err != nil {
+			t.Fatalf("RestoreVideo: %v", err)
+		}
+		restored, _ := c.GetVideo(video.ID)
+		if restored.ID != video.ID || restored.DeletedAt != nil {
+			t.Errorf("GetVideo after RestoreVideo = %+v", restored)
+		}
+		if restored.Revision != trashed.Revision+1 || !restored.UpdatedAt.After(trashed.UpdatedAt) {
+			t.Error("RestoreVideo didn't bump the revision and updated_at")
+		}
+	})
+}
+
+func TestVideoTakedown(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		video.Visibility = VideoPublic
+		if err := c.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := c.GetVideo(video.ID)
+
+		if err := c.TakeDownVideo(video.ID, "spam"); err != nil {
+			t.Fatalf("TakeDownVideo: %v", err)
+		}
+		taken, _ := c.GetVideo(video.ID)
+		if taken.TakenDownAt == nil || taken.TakedownReason == nil || *taken.TakedownReason != "spam" || taken.Visibility != VideoPrivate {
+			t.Errorf("video after TakeDownVideo = %+v", taken)
+		}
+		if taken.Revision <= before.Revision || !taken.UpdatedAt.After(before.UpdatedAt) {
+			t.Error("TakeDownVideo didn't bump the revision and updated_at")
+		}
+
+		// Even if it ends up public again, lists for other users leave it out.
+		taken.Visibility = VideoPublic
+		if err := c.UpdateVideo(taken); err != nil {
+			t.Fatal(err)
+		}
+		params := ListVideosParams{UserID: user.ID, Sort: VideoSortCreated, Limit: 10, Visibility: VideoPublic}
+		if page, err := c.ListVideos(params); err != nil || len(page.Videos) != 1 {
+			t.Errorf("ListVideos = %+v, %v, want the taken down video", page, err)
+		}
+		params.HideTakenDown = true
+		if page, err := c.ListVideos(params); err != nil || len(page.Videos) != 0 {
+			t.Errorf("ListVideos hiding taken down videos = %+v, %v, want none", page, err)
+		}
+		taken.Visibility = VideoPrivate
+		if err := c.UpdateVideo(taken); err != nil {
+			t.Fatal(err)
+		}
+		taken, _ = c.GetVideo(video.ID)
+
+		if err := c.ReinstateVideo(video.ID); err != nil {
+			t.Fatalf("ReinstateVideo: %v", err)
+		}
+		reinstated, _ := c.GetVideo(video.ID)
+		if reinstated.TakenDownAt != nil || reinstated.TakedownReason != nil || reinstated.Visibility != VideoPrivate {
+			t.Errorf("video after ReinstateVideo = %+v", reinstated)
+		}
+		if reinstated.Revision <= taken.Revision {
+			t.Error("ReinstateVideo didn't bump the revision")
+		}
+	})
+}
+
+func TestSetVideoURLs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		video.Visibility = VideoPublic
+		if err := c.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		// A moderator takes the video down while an upload is running.
+		if err := c.TakeDownVideo(video.ID, "spam"); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := c.GetVideo(video.ID)
+
+		if err := c.SetVideoURL(video.ID, "http://localhost/assets/a.mp4"); err != nil {
+			t.Fatalf("SetVideoURL: %v", err)
+		}
+		if err := c.SetVideoThumbnailURL(video.ID, "http://localhost/assets/a.png"); err != nil {
+			t.Fatalf("SetVideoThumbnailURL: %v", err)
+		}
+		got, _ := c.GetVideo(video.ID)
+		if got.VideoURL == nil || *got.VideoURL != "http://localhost/assets/a.mp4" || got.ThumbnailURL == nil || *got.ThumbnailURL != "http://localhost/assets/a.png" {
+			t.Errorf("URLs after setting them = %v, %v", got.VideoURL, got.ThumbnailURL)
+		}
+		if got.Visibility != VideoPrivate || got.TakenDownAt == nil || got.Title != "cats" {
+			t.Errorf("setting the URLs changed other fields: %+v", got)
+		}
+		if got.Revision != before.Revision+2 {
+			t.Errorf("revision = %d, want %d", got.Revision, before.Revision+2)
+		}
+	})
+}
+
+func TestDeleteVideo(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		video := createTestVideo(t, c, user.ID, "cats")
+		other := createTestVideo(t, c, user.ID, "dogs")
+		asset, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: "a.mp4", Size: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.CreateVideoVersion(CreateVideoVersionParams{VideoID: video.ID, AssetID: asset.ID, UploadedBy: user.ID}); err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range []string{"only-cats", "shared"} {
+			if _, err := c.AddVideoTag(user.ID, video.ID, tag); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := c.AddVideoTag(user.ID, other.ID, "shared"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.DeleteVideo(video.ID); err != nil {
+			t.Fatalf("DeleteVideo: %v", err)
+		}
+		if got, _ := c.GetVideo(video.ID); got.ID != uuid.Nil {
+			t.Error("video is still there")
+		}
+		if got, _ := c.GetVideoVersions(video.ID); len(got) != 0 {
+			t.Errorf("%d versions are left", len(got))
+		}
+		tags, err := c.GetUserTags(user.ID)
+		if err != nil || len(tags) != 1 || tags[0].Name != "shared" {
+			t.Errorf("tags left = %+v, %v", tags, err)
+		}
+	})
+}
+
+func titles(videos []Video) string {
+	names := make([]string, len(videos))
+	for i, video := range videos {
+		names[i] = video.Title
+	}
+	return strings.Join(names, ",")
+}
+
+// listAllVideos follows the cursors of ListVideos and returns the titles of
+// each page.
+func listAllVideos(t *testing.T, c Client, params ListVideosParams) []string {
+	t.Helper()
+	pages := []string{}
+	for i := 0; ; i++ {
+		if i > 10 {
+			t.Fatal("ListVideos keeps returning pages")
+		}
+		page, err := c.ListVideos(params)
+		if err != nil {
+			t.Fatalf("ListVideos: %v", err)
+		}
+		pages = append(pages, titles(page.Videos))
+		if page.NextCursor == "" {
+			return pages
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+func TestListVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		other := createTestUser(t, c)
+		createTestVideo(t, c, other.ID, "other user's")
+
+		// Each video gets a version, with a duration and aspect ratio, and a
+		// tag; c and e are public.
+		videos := map[string]Video{}
+		for i, title := range []string{"b", "a", "e", "c", "d"} {
+			video := createTestVideo(t, c, user.ID, title)
+			asset, err := c.CreateAsset(CreateAssetParams{UserID: user.ID, VideoID: video.ID, Category: AssetCategoryVideo, StorageKey: title + ".mp4", Size: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			aspect := "16:9"
+			if title == "d" {
+				aspect = "9:16"
+			}
+			_, err = c.CreateVideoVersion(CreateVideoVersionParams{VideoID: video.ID, AssetID: asset.ID, UploadedBy: user.ID, DurationSeconds: float64(10 * (i + 1)), AspectRatio: aspect})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title == "c" || title == "e" {
+				video.Visibility = VideoPublic
+			}
+			if title != "a" {
+				url := "http://localhost/assets/" + title + ".mp4"
+				video.VideoURL = &url
+			}
+			if err := c.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.AddVideoTag(user.ID, video.ID, map[bool]string{true: "vowel", false: "consonant"}[title == "a" || title == "e"]); err != nil {
+				t.Fatal(err)
+			}
+			videos[title] = video
+		}
+		trashed := createTestVideo(t, c, user.ID, "trashed")
+		if err := c.TrashVideo(trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		yes, no := true, false
+		hourAgo, inAnHour := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+		tests := []struct {
+			name   string
+			params ListVideosParams
+			want   []string
+		}{
+			{"title ascending", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 2}, []string{"a,b", "c,d", "e"}},
+			{"title descending", ListVideosParams{Sort: VideoSortTitle, Limit: 3}, []string{"e,d,c", "b,a"}},
+			{"duration", ListVideosParams{Sort: VideoSortDuration, Limit: 2}, []string{"d,c", "e,a", "b"}},
+			{"exact pages", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 5}, []string{"a,b,c,d,e"}},
+			{"public", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Visibility: VideoPublic}, []string{"c,e"}},
+			{"has video", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, HasVideo: &yes}, []string{"b,c,d,e"}},
+			{"has no video", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, HasVideo: &no}, []string{"a"}},
+			{"portrait", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Orientation: VideoOrientationPortrait}, []string{"d"}},
+			{"landscape", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Orientation: VideoOrientationLandscape}, []string{"a,b,c,e"}},
+			{"other orientation", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Orientation: VideoOrientationOther}, []string{""}},
+			{"tag", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Tags: []string{"vowel"}}, []string{"a,e"}},
+			{"every tag", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Tags: []string{"vowel", "consonant"}}, []string{""}},
+			{"created after", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, CreatedAfter: &hourAgo}, []string{"a,b,c,d,e"}},
+			{"created before", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, CreatedBefore: &hourAgo}, []string{""}},
+			{"created in range", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, CreatedAfter: &hourAgo, CreatedBefore: &inAnHour}, []string{"a,b,c,d,e"}},
+			{"trash", ListVideosParams{Sort: VideoSortTitle, Ascending: true, Limit: 10, Trashed: true}, []string{"trashed"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.params.UserID = user.ID
+				got := listAllVideos(t, c, tt.params)
+				if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+					t.Errorf("pages = %q, want %q", got, tt.want)
+				}
+			})
+		}
+
+		// Videos created in the same second tie on created_at and updated_at,
+		// and are told apart by ID.
+		for _, sort := range []VideoSort{VideoSortCreated, VideoSortUpdated} {
+			pages := listAllVideos(t, c, ListVideosParams{UserID: user.ID, Sort: sort, Limit: 2})
+			seen := map[string]bool{}
+			for _, title := range strings.Split(strings.Join(pages, ","), ",") {
+				if seen[title] {
+					t.Errorf("sorting by %s, %s is on two pages", sort, title)
+				}
+				seen[title] = true
+			}
+			if len(seen) != len(videos) {
+				t.Errorf("sorting by %s, pages %q don't have every video", sort, pages)
+			}
+		}
+
+		first, err := c.ListVideos(ListVideosParams{UserID: user.ID, Sort: VideoSortTitle, Ascending: true, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cursor := range []string{"not a cursor", first.NextCursor} {
+			_, err := c.ListVideos(ListVideosParams{UserID: user.ID, Sort: VideoSortCreated, Limit: 2, Cursor: cursor})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ListVideos with cursor %q = %v, want ErrInvalidCursor", cursor, err)
+			}
+		}
+	})
+}
+
+func TestSearchVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c)
+		other := createTestUser(t, c)
+		create := func(userID uuid.UUID, title, description string) Video {
+			video, err := c.CreateVideo(CreateVideoParams{UserID: userID, Title: title, Description: description})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return video
+		}
+		inTitle := create(user.ID, "Cats <3 boxes", "a video")
+		inDescription := create(user.ID, "Weekend", "the cat sat in a box all weekend")
+		create(user.ID, "Dogs", "no felines here")
+		create(other.ID, "Cats of another user", "cat")
+		trashed := create(user.ID, "Trashed cat", "cat")
+		if err := c.TrashVideo(trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat", Limit: 10})
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(page.Results) != 2 || page.NextCursor != "" {
+			t.Fatalf("SearchVideos = %+v", page)
+		}
+		if page.Results[0].ID != inTitle.ID || page.Results[1].ID != inDescription.ID {
+			t.Errorf("results are %q, %q; want the title match first", page.Results[0].Title, page.Results[1].Title)
+		}
+		if page.Results[0].Rank <= page.Results[1].Rank {
+			t.Errorf("ranks are %v, %v; want them descending", page.Results[0].Rank, page.Results[1].Rank)
+		}
+		if got := page.Results[0].TitleHighlight; got != "<mark>Cats</mark> &lt;3 boxes" {
+			t.Errorf("title highlight = %q", got)
+		}
+		if got := page.Results[1].DescriptionSnippet; !strings.Contains(got, "the <mark>cat</mark> sat") {
+			t.Errorf("description snippet = %q", got)
+		}
+
+		page, err = c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat box", Limit: 10})
+		if err != nil || len(page.Results) != 2 {
+			t.Errorf("searching for every word = %d results, %v", len(page.Results), err)
+		}
+		page, err = c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat dog", Limit: 10})
+		if err != nil || len(page.Results) != 0 {
+			t.Errorf("searching for words no video has together = %d results, %v", len(page.Results), err)
+		}
+		for _, query := range []string{`" OR *`, "NEAR(cat", "title:cat", "!!!"} {
+			if _, err := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: query, Limit: 10}); err != nil {
+				t.Errorf("SearchVideos(%q): %v", query, err)
+			}
+		}
+
+		first, err := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat", Limit: 1})
+		if err != nil || len(first.Results) != 1 || first.NextCursor == "" {
+			t.Fatalf("first page = %+v, %v", first, err)
+		}
+		second, err := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat", Limit: 1, Cursor: first.NextCursor})
+		if err != nil || len(second.Results) != 1 || second.NextCursor != "" {
+			t.Fatalf("second page = %+v, %v", second, err)
+		}
+		if second.Results[0].ID != inDescription.ID {
+			t.Errorf("second page has %q", second.Results[0].Title)
+		}
+		if _, err := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat", Limit: 1, Cursor: "!"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("SearchVideos with a bad cursor = %v, want ErrInvalidCursor", err)
+		}
+
+		// The index follows edits.
+		inDescription.Description = "nothing to see"
+		if err := c.UpdateVideo(inDescription); err != nil {
+			t.Fatal(err)
+		}
+		page, err = c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "cat", Limit: 10})
+		if err != nil || len(page.Results) != 1 {
+			t.Errorf("after editing, SearchVideos = %d results, %v", len(page.Results), err)
+		}
+
+		// Other users' videos are found while they are public and not taken
+		// down.
+		otherVideos := map[VideoVisibility]Video{}
+		for _, visibility := range []VideoVisibility{VideoPublic, VideoUnlisted} {
+			video := create(other.ID, "Kittens", "kitten")
+			video.Visibility = visibility
+			if err := c.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			otherVideos[visibility] = video
+		}
+		page, err = c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "kitten", Limit: 10})
+		if err != nil || len(page.Results) != 1 || page.Results[0].ID != otherVideos[VideoPublic].ID {
+			t.Errorf("searching other users' videos = %+v, %v, want only the public one", page.Results, err)
+		}
+		if page, _ := c.SearchVideos(SearchVideosParams{UserID: other.ID, Query: "kitten", Limit: 10}); len(page.Results) != 2 {
+			t.Errorf("owner found %d of their videos, want 2", len(page.Results))
+		}
+		if err := c.TakeDownVideo(otherVideos[VideoPublic].ID, "spam"); err != nil {
+			t.Fatal(err)
+		}
+		taken, _ := c.GetVideo(otherVideos[VideoPublic].ID)
+		taken.Visibility = VideoPublic
+		if err := c.UpdateVideo(taken); err != nil {
+			t.Fatal(err)
+		}
+		if page, _ := c.SearchVideos(SearchVideosParams{UserID: user.ID, Query: "kitten", Limit: 10}); len(page.Results) != 0 {
+			t.Errorf("found %d taken down videos of another user, want none", len(page.Results))
+		}
+	})
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Encrypted files start with a header holding the ID of the key-encryption key
+// and the data key wrapped with it, followed by the content split into
+// segments that are sealed separately with AES-GCM. Segments can be decrypted
+// without reading the ones before them, and the last one is flagged so
+// truncation is detected.
+//
+//	magic | len(keyID) | keyID | wrapped data key | nonce prefix | segments...
+const (
+	envelopeMagic     = "TBLYENC1"
+	segmentSize       = 64 << 10
+	dataKeySize       = 32
+	noncePrefixSize   = 8
+	gcmNonceSize      = 12
+	gcmTagSize        = 16
+	wrappedKeySize    = gcmNonceSize + dataKeySize + gcmTagSize
+	sealedSegmentSize = segmentSize + gcmTagSize
+)
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyRing holds the key-encryption keys for the local backend. New files are
+// encrypted with the active key; the others are kept so files written before a
+// rotation can still be read.
+type KeyRing struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewKeyRing(activeID string, keys map[string][]byte) (*KeyRing, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the key ring", activeID)
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	return &KeyRing{active: activeID, keys: keys}, nil
+}
+
+// ParseKeyRing parses a comma separated list of id:base64key pairs. The first
+// key in the list is the active one.
+func ParseKeyRing(spec string) (*KeyRing, error) {
+	keys := map[string][]byte{}
+	active := ""
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("key ring entry %q must look like id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode key %q: %w", id, err)
+		}
+		if active == "" {
+			active = id
+		}
+		keys[id] = key
+	}
+	return NewKeyRing(active, keys)
+}
+
+func (kr *KeyRing) ActiveID() string {
+	return kr.active
+}
+
+type envelopeHeader struct {
+	keyID       string
+	wrappedKey  []byte
+	noncePrefix []byte
+}
+
+func (h envelopeHeader) size() int64 {
+	return int64(len(envelopeMagic) + 1 + len(h.keyID) + wrappedKeySize + noncePrefixSize)
+}
+
+func (h envelopeHeader) marshal() []byte {
+	buf := make([]byte, 0, h.size())
+	buf = append(buf, envelopeMagic...)
+	buf = append(buf, byte(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = append(buf, h.wrappedKey...)
+	buf = append(buf, h.noncePrefix...)
+	return buf
+}
+
+// readEnvelopeHeader reads the header of an encrypted file. It returns false
+// when the content doesn't start with the envelope magic, which means the file
+// was written in plaintext.
+func readEnvelopeHeader(r io.Reader) (envelopeHeader, bool, error) {
+	magic := make([]byte, len(envelopeMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return envelopeHeader{}, false, nil
+		}
+		return envelopeHeader{}, false, err
+	}
+	if string(magic[:len(envelopeMagic)]) != envelopeMagic {
+		return envelopeHeader{}, false, nil
+	}
+
+	rest := make([]byte, int(magic[len(envelopeMagic)])+wrappedKeySize+noncePrefixSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return envelopeHeader{}, true, fmt.Errorf("truncated encryption header: %w", err)
+	}
+	idLen := int(magic[len(envelopeMagic)])
+	return envelopeHeader{
+		keyID:       string(rest[:idLen]),
+		wrappedKey:  rest[idLen : idLen+wrappedKeySize],
+		noncePrefix: rest[idLen+wrappedKeySize:],
+	}, true, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newHeader generates a data key and wraps it with the active key.
+func (kr *KeyRing) newHeader() (envelopeHeader, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return envelopeHeader{}, nil, err
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return envelopeHeader{}, nil, err
+	}
+	h := envelopeHeader{keyID: kr.active, noncePrefix: noncePrefix}
+	if err := kr.wrap(&h, dataKey); err != nil {
+		return envelopeHeader{}, nil, err
+	}
+	return h, dataKey, nil
+}
+
+func (kr *KeyRing) wrap(h *envelopeHeader, dataKey []byte) error {
+	aead, err := newGCM(kr.keys[kr.active])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	h.keyID = kr.active
+	h.wrappedKey = aead.Seal(nonce, nonce, dataKey, []byte(kr.active))
+	return nil
+}
+
+func (kr *KeyRing) unwrap(h envelopeHeader) ([]byte, error) {
+	key, ok := kr.keys[h.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, h.keyID)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, sealed := h.wrappedKey[:gcmNonceSize], h.wrappedKey[gcmNonceSize:]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(h.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func segmentNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, gcmNonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	return nonce
+}
+
+func segmentAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encrypt writes src to dst as an encrypted envelope using the active key.
+func (kr *KeyRing) encrypt(dst io.Writer, src io.Reader) error {
+	h, dataKey, err := kr.newHeader()
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(h.marshal()); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(src, segmentSize)
+	plain := make([]byte, segmentSize)
+	sealed := make([]byte, 0, sealedSegmentSize)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, plain)
+		final := false
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			final = true
+		case err != nil:
+			return err
+		default:
+			if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		sealed = aead.Seal(sealed[:0], segmentNonce(h.noncePrefix, counter), plain[:n], segmentAAD(final))
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// plaintextSize works out the size of the content in an envelope from the
+// size of its segments.
+func plaintextSize(segmentsSize int64) int64 {
+	segments := (segmentsSize + sealedSegmentSize - 1) / sealedSegmentSize
+	return segmentsSize - segments*gcmTagSize
+}
+
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	sealed  []byte
+	plain   []byte
+	done    bool
+}
+
+// newDecryptReaderAt returns a reader over the plaintext of the segments in
+// src, which must be positioned at the start of the given segment.
+func (kr *KeyRing) newDecryptReaderAt(src io.Reader, h envelopeHeader, segment uint32) (io.Reader, error) {
+	dataKey, err := kr.unwrap(h)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:     bufio.NewReaderSize(src, sealedSegmentSize),
+		aead:    aead,
+		prefix:  h.noncePrefix,
+		counter: segment,
+		sealed:  make([]byte, sealedSegmentSize),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.src, d.sealed)
+	final := false
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("encrypted file is truncated: %w", io.ErrUnexpectedEOF)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		final = true
+	case err != nil:
+		return err
+	default:
+		if _, err := d.src.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := d.aead.Open(d.sealed[:0], segmentNonce(d.prefix, d.counter), d.sealed[:n], segmentAAD(final))
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt segment %d: %w", d.counter, err)
+	}
+	d.plain = plain
+	d.counter++
+	d.done = final
+	return nil
+}
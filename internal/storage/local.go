@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Local stores objects as files under a root directory. When it has a key
+// ring, files are written with envelope encryption; plaintext files written
+// before encryption was enabled can still be read.
+type Local struct {
+	root string
+	keys *KeyRing
+}
+
+func NewLocal(root string, keys *KeyRing) *Local {
+	return &Local{root: root, keys: keys}
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.ReadSeeker, opts PutOptions) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	return l.writeFile(path, func(f *os.File) error {
+		if l.keys != nil {
+			return l.keys.encrypt(f, body)
+		}
+		_, err := io.Copy(f, body)
+		return err
+	})
+}
+
+// writeFile writes to a temporary file next to path and renames it into
+// place, so readers never see a partially written object.
+func (l *Local) writeFile(path string, write func(f *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, Object{}, notFound(err)
+	}
+
+	obj, h, encrypted, err := l.stat(key, f)
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+	if !encrypted {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, Object{}, err
+		}
+		return f, obj, nil
+	}
+
+	if l.keys == nil {
+		f.Close()
+		return nil, Object{}, fmt.Errorf("%s is encrypted but no keys are configured", key)
+	}
+	if _, err := f.Seek(h.size(), io.SeekStart); err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+	r, err := l.keys.newDecryptReaderAt(f, h, 0)
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+	return readCloser{Reader: r, Closer: f}, obj, nil
+}
+
+func (l *Local) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	obj, h, encrypted, err := l.stat(key, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var r io.Reader
+	if !encrypted && offset >= obj.Size {
+		r = bytes.NewReader(nil)
+	} else if !encrypted {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r = f
+	} else {
+		if l.keys == nil {
+			f.Close()
+			return nil, fmt.Errorf("%s is encrypted but no keys are configured", key)
+		}
+		// Start decrypting at the segment holding offset and skip the part of
+		// it that comes before. Reads past the end still decrypt the last
+		// segment, since that is where truncation is detected.
+		offset = min(offset, obj.Size)
+		segment := offset / segmentSize
+		if segment > 0 && segment*segmentSize == obj.Size {
+			segment--
+		}
+		if _, err := f.Seek(h.size()+segment*sealedSegmentSize, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		dr, err := l.keys.newDecryptReaderAt(f, h, uint32(segment))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, dr, offset-segment*segmentSize); err != nil && !errors.Is(err, io.EOF) {
+			f.Close()
+			return nil, err
+		}
+		r = dr
+	}
+
+	if length >= 0 {
+		r = io.LimitReader(r, length)
+	}
+	return readCloser{Reader: r, Closer: f}, nil
+}
+
+func (l *Local) Head(ctx context.Context, key string) (Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Object{}, notFound(err)
+	}
+	defer f.Close()
+
+	obj, _, _, err := l.stat(key, f)
+	return obj, err
+}
+
+// stat describes the object stored in f, reading its encryption header if it
+// has one. f is left at an unspecified offset.
+func (l *Local) stat(key string, f *os.File) (Object, envelopeHeader, bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Object{}, envelopeHeader{}, false, err
+	}
+	obj := Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+
+	h, encrypted, err := readEnvelopeHeader(f)
+	if err != nil {
+		return Object{}, envelopeHeader{}, false, err
+	}
+	if encrypted {
+		obj.Size = plaintextSize(info.Size() - h.size())
+	}
+	return obj, h, encrypted, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Rotate rewraps the data key of an encrypted file with the active key, which
+// only rewrites the header. Plaintext files are encrypted in full.
+func (l *Local) Rotate(ctx context.Context, key string) error {
+	if l.keys == nil {
+		return nil
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return notFound(err)
+	}
+	defer f.Close()
+
+	h, encrypted, err := readEnvelopeHeader(f)
+	if err != nil {
+		return err
+	}
+	if encrypted && h.keyID == l.keys.ActiveID() {
+		return nil
+	}
+
+	if !encrypted {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return l.writeFile(path, func(dst *os.File) error {
+			return l.keys.encrypt(dst, f)
+		})
+	}
+
+	dataKey, err := l.keys.unwrap(h)
+	if err != nil {
+		return err
+	}
+	if err := l.keys.wrap(&h, dataKey); err != nil {
+		return err
+	}
+	return l.writeFile(path, func(dst *os.File) error {
+		if _, err := dst.Write(h.marshal()); err != nil {
+			return err
+		}
+		_, err := io.Copy(dst, f)
+		return err
+	})
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func newTestKeyRing(t *testing.T, active string, keys map[string][]byte) *KeyRing {
+	t.Helper()
+	kr, err := NewKeyRing(active, keys)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return kr
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+// readObject reads a whole object, returning the error from Get or from
+// reading, since decryption errors can surface in either.
+func readObject(l *Local, key string) ([]byte, Object, error) {
+	rc, obj, err := l.Get(context.Background(), key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	return data, obj, err
+}
+
+func TestLocalPutGet(t *testing.T) {
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 7}
+	backends := []struct {
+		name string
+		keys *KeyRing
+	}{
+		{"plaintext", nil},
+		{"encrypted", newTestKeyRing(t, "1", map[string][]byte{"1": testKey1})},
+	}
+
+	for _, backend := range backends {
+		for _, size := range sizes {
+			dir := t.TempDir()
+			l := NewLocal(dir, backend.keys)
+			data := testData(size)
+
+			if err := l.Put(context.Background(), "videos/a.mp4", bytes.NewReader(data), PutOptions{}); err != nil {
+				t.Fatalf("%s/%d: Put: %v", backend.name, size, err)
+			}
+			got, obj, err := readObject(l, "videos/a.mp4")
+			if err != nil {
+				t.Fatalf("%s/%d: Get: %v", backend.name, size, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s/%d: Get returned %d different bytes", backend.name, size, len(got))
+			}
+			if obj.Size != int64(size) || obj.ContentType != "video/mp4" {
+				t.Errorf("%s/%d: Get described the object as %+v", backend.name, size, obj)
+			}
+			head, err := l.Head(context.Background(), "videos/a.mp4")
+			if err != nil || head.Size != int64(size) {
+				t.Errorf("%s/%d: Head = %+v, %v", backend.name, size, head, err)
+			}
+			rc, err := l.GetRange(context.Background(), "videos/a.mp4", int64(size), 10)
+			if err != nil {
+				t.Fatalf("%s/%d: GetRange at the end: %v", backend.name, size, err)
+			}
+			rest, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || len(rest) != 0 {
+				t.Errorf("%s/%d: GetRange at the end = %d bytes, %v", backend.name, size, len(rest), err)
+			}
+
+			raw, err := os.ReadFile(filepath.Join(dir, "videos", "a.mp4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encrypted := bytes.HasPrefix(raw, []byte(envelopeMagic)); encrypted != (backend.keys != nil) {
+				t.Errorf("%s/%d: file on disk encrypted = %v", backend.name, size, encrypted)
+			}
+		}
+	}
+}
+
+func TestLocalGetRange(t *testing.T) {
+	const size = 3*segmentSize + 7
+	data := testData(size)
+	l := NewLocal(t.TempDir(), newTestKeyRing(t, "1", map[string][]byte{"1": testKey1}))
+	if err := l.Put(context.Background(), "a.mp4", bytes.NewReader(data), PutOptions{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           []byte
+	}{
+		{"start", 0, 10, data[:10]},
+		{"across a segment boundary", segmentSize - 10, 20, data[segmentSize-10 : segmentSize+10]},
+		{"across two boundaries", segmentSize - 1, segmentSize + 2, data[segmentSize-1 : 2*segmentSize+1]},
+		{"at a segment boundary", 2 * segmentSize, 5, data[2*segmentSize : 2*segmentSize+5]},
+		{"to the end", segmentSize + 3, -1, data[segmentSize+3:]},
+		{"past the end", size - 3, 10, data[size-3:]},
+		{"beyond the end", size + 5, 10, []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := l.GetRange(context.Background(), "a.mp4", tt.offset, tt.length)
+			if err != nil {
+				t.Fatalf("GetRange: %v", err)
+			}
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("reading range: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %d bytes, want %d matching bytes", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestLocalRotate(t *testing.T) {
+	dir := t.TempDir()
+	data := testData(2*segmentSize + 3)
+	oldKeys := NewLocal(dir, newTestKeyRing(t, "1", map[string][]byte{"1": testKey1}))
+	bothKeys := NewLocal(dir, newTestKeyRing(t, "2", map[string][]byte{"1": testKey1, "2": testKey2}))
+	newKeys := NewLocal(dir, newTestKeyRing(t, "2", map[string][]byte{"2": testKey2}))
+	plaintext := NewLocal(dir, nil)
+
+	if err := oldKeys.Put(context.Background(), "old.mp4", bytes.NewReader(data), PutOptions{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := plaintext.Put(context.Background(), "plain.mp4", bytes.NewReader(data), PutOptions{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, _, err := readObject(newKeys, "old.mp4"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("reading before rotation without the old key: got %v, want ErrUnknownKey", err)
+	}
+
+	for _, key := range []string{"old.mp4", "plain.mp4"} {
+		if err := bothKeys.Rotate(context.Background(), key); err != nil {
+			t.Fatalf("Rotate(%s): %v", key, err)
+		}
+		got, _, err := readObject(newKeys, key)
+		if err != nil {
+			t.Fatalf("reading %s with only the new key: %v", key, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s changed when it was rotated", key)
+		}
+	}
+
+	// Rotating again is a no-op.
+	before, err := os.ReadFile(filepath.Join(dir, "old.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bothKeys.Rotate(context.Background(), "old.mp4"); err != nil {
+		t.Fatalf("second Rotate: %v", err)
+	}
+	after, err := os.ReadFile(filepath.Join(dir, "old.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("rotating a file already on the active key rewrote it")
+	}
+}
+
+func TestLocalTamperedCiphertext(t *testing.T) {
+	const size = 2*segmentSize + 5
+	keys := newTestKeyRing(t, "1", map[string][]byte{"1": testKey1})
+	headerSize := envelopeHeader{keyID: "1"}.size()
+
+	tests := []struct {
+		name   string
+		tamper func(raw []byte) []byte
+	}{
+		{"truncated inside the last segment", func(raw []byte) []byte {
+			return raw[:len(raw)-3]
+		}},
+		{"last segment cut off", func(raw []byte) []byte {
+			return raw[:headerSize+2*sealedSegmentSize]
+		}},
+		{"all segments cut off", func(raw []byte) []byte {
+			return raw[:headerSize]
+		}},
+		{"flipped bit in a segment", func(raw []byte) []byte {
+			raw[headerSize+sealedSegmentSize+100] ^= 1
+			return raw
+		}},
+		{"flipped bit in the wrapped key", func(raw []byte) []byte {
+			raw[headerSize-noncePrefixSize-1] ^= 1
+			return raw
+		}},
+		{"swapped segments", func(raw []byte) []byte {
+			first := raw[headerSize : headerSize+sealedSegmentSize]
+			second := append([]byte{}, raw[headerSize+sealedSegmentSize:headerSize+2*sealedSegmentSize]...)
+			copy(raw[headerSize+sealedSegmentSize:], first)
+			copy(raw[headerSize:], second)
+			return raw
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			l := NewLocal(dir, keys)
+			if err := l.Put(context.Background(), "a.mp4", bytes.NewReader(testData(size)), PutOptions{}); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			path := filepath.Join(dir, "a.mp4")
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.tamper(raw), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := readObject(l, "a.mp4"); err == nil {
+				t.Error("Get read a tampered file without an error")
+			}
+			rc, err := l.GetRange(context.Background(), "a.mp4", segmentSize, -1)
+			if err == nil {
+				_, err = io.ReadAll(rc)
+				rc.Close()
+			}
+			if err == nil {
+				t.Error("GetRange read a tampered file without an error")
+			}
+		})
+	}
+}
+
+func TestLocalInvalidKeys(t *testing.T) {
+	l := NewLocal(t.TempDir(), nil)
+	for _, key := range []string{"../escape", "/abs", ""} {
+		if err := l.Put(context.Background(), key, bytes.NewReader(nil), PutOptions{}); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+	if _, _, err := l.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type SSEMode string
+
+const (
+	SSENone SSEMode = ""
+	SSES3   SSEMode = "sse-s3"
+	SSEKMS  SSEMode = "sse-kms"
+	SSEC    SSEMode = "sse-c"
+)
+
+// S3Encryption configures server-side encryption for every object written to
+// a bucket. With SSE-C the same customer key has to be sent on every read, and
+// PreviousCustomerKey is tried when the current one doesn't match so objects
+// can still be read while they are being rotated.
+type S3Encryption struct {
+	Mode                SSEMode
+	KMSKeyID            string
+	CustomerKey         []byte
+	PreviousCustomerKey []byte
+}
+
+func (e S3Encryption) Validate() error {
+	switch e.Mode {
+	case SSENone, SSES3:
+	case SSEKMS:
+	case SSEC:
+		if len(e.CustomerKey) != 32 {
+			return fmt.Errorf("SSE-C customer key must be 32 bytes, got %d", len(e.CustomerKey))
+		}
+		if e.PreviousCustomerKey != nil && len(e.PreviousCustomerKey) != 32 {
+			return fmt.Errorf("previous SSE-C customer key must be 32 bytes, got %d", len(e.PreviousCustomerKey))
+		}
+	default:
+		return fmt.Errorf("unknown server-side encryption mode %q", e.Mode)
+	}
+	return nil
+}
+
+type customerKey struct {
+	algorithm string
+	key       string
+	md5       string
+}
+
+func newCustomerKey(key []byte) *customerKey {
+	if key == nil {
+		return nil
+	}
+	sum := md5.Sum(key)
+	return &customerKey{
+		algorithm: "AES256",
+		key:       base64.StdEncoding.EncodeToString(key),
+		md5:       base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+type S3 struct {
+	client   *s3.Client
+	bucket   string
+	enc      S3Encryption
+	current  *customerKey
+	previous *customerKey
+}
+
+func NewS3(client *s3.Client, bucket string, enc S3Encryption) (*S3, error) {
+	if err := enc.Validate(); err != nil {
+		return nil, err
+	}
+	b := &S3{client: client, bucket: bucket, enc: enc}
+	if enc.Mode == SSEC {
+		b.current = newCustomerKey(enc.CustomerKey)
+		b.previous = newCustomerKey(enc.PreviousCustomerKey)
+	}
+	return b, nil
+}
+
+func (b *S3) Bucket() string {
+	return b.bucket
+}
+
+func (b *S3) Put(ctx context.Context, key string, body io.ReadSeeker, opts PutOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = opts.Metadata
+	}
+	switch b.enc.Mode {
+	case SSES3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case SSEKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if b.enc.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(b.enc.KMSKeyID)
+		}
+	case SSEC:
+		input.SSECustomerAlgorithm = aws.String(b.current.algorithm)
+		input.SSECustomerKey = aws.String(b.current.key)
+		input.SSECustomerKeyMD5 = aws.String(b.current.md5)
+	}
+
+	_, err := b.client.PutObject(ctx, input)
+	return err
+}
+
+func (b *S3) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	var out *s3.GetObjectOutput
+	err := b.withCustomerKey(func(ck *customerKey) error {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(key),
+		}
+		if ck != nil {
+			input.SSECustomerAlgorithm = aws.String(ck.algorithm)
+			input.SSECustomerKey = aws.String(ck.key)
+			input.SSECustomerKeyMD5 = aws.String(ck.md5)
+		}
+		var err error
+		out, err = b.client.GetObject(ctx, input)
+		return err
+	})
+	if err != nil {
+		return nil, Object{}, s3NotFound(err)
+	}
+
+	obj := Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}
+	return out.Body, obj, nil
+}
+
+func (b *S3) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		rng = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	var out *s3.GetObjectOutput
+	err := b.withCustomerKey(func(ck *customerKey) error {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(key),
+			Range:  aws.String(rng),
+		}
+		if ck != nil {
+			input.SSECustomerAlgorithm = aws.String(ck.algorithm)
+			input.SSECustomerKey = aws.String(ck.key)
+			input.SSECustomerKeyMD5 = aws.String(ck.md5)
+		}
+		var err error
+		out, err = b.client.GetObject(ctx, input)
+		return err
+	})
+	if err != nil {
+		return nil, s3NotFound(err)
+	}
+	return out.Body, nil
+}
+
+func (b *S3) Head(ctx context.Context, key string) (Object, error) {
+	out, _, err := b.head(ctx, key)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// head returns the object's metadata along with the SSE-C key that opened it.
+func (b *S3) head(ctx context.Context, key string) (*s3.HeadObjectOutput, *customerKey, error) {
+	var out *s3.HeadObjectOutput
+	var used *customerKey
+	err := b.withCustomerKey(func(ck *customerKey) error {
+		input := &s3.HeadObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(key),
+		}
+		if ck != nil {
+			input.SSECustomerAlgorithm = aws.String(ck.algorithm)
+			input.SSECustomerKey = aws.String(ck.key)
+			input.SSECustomerKeyMD5 = aws.String(ck.md5)
+		}
+		var err error
+		out, err = b.client.HeadObject(ctx, input)
+		used = ck
+		return err
+	})
+	if err != nil {
+		return nil, nil, s3NotFound(err)
+	}
+	return out, used, nil
+}
+
+func (b *S3) Delete(ctx context.Context, key string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Rotate copies an object onto itself with the current encryption settings
+// when it was written with different ones.
+func (b *S3) Rotate(ctx context.Context, key string) error {
+	head, used, err := b.head(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(b.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(copySource(b.bucket, key)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	switch b.enc.Mode {
+	case SSENone:
+		return nil
+	case SSES3:
+		if head.ServerSideEncryption == types.ServerSideEncryptionAes256 {
+			return nil
+		}
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case SSEKMS:
+		if head.ServerSideEncryption == types.ServerSideEncryptionAwsKms &&
+			(b.enc.KMSKeyID == "" || strings.HasSuffix(aws.ToString(head.SSEKMSKeyId), b.enc.KMSKeyID)) {
+			return nil
+		}
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if b.enc.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(b.enc.KMSKeyID)
+		}
+	case SSEC:
+		if used == b.current {
+			return nil
+		}
+		if used != nil {
+			input.CopySourceSSECustomerAlgorithm = aws.String(used.algorithm)
+			input.CopySourceSSECustomerKey = aws.String(used.key)
+			input.CopySourceSSECustomerKeyMD5 = aws.String(used.md5)
+		}
+		input.SSECustomerAlgorithm = aws.String(b.current.algorithm)
+		input.SSECustomerKey = aws.String(b.current.key)
+		input.SSECustomerKeyMD5 = aws.String(b.current.md5)
+	}
+
+	_, err = b.client.CopyObject(ctx, input)
+	return err
+}
+
+// withCustomerKey runs a request with the current SSE-C key, retrying with the
+// previous one and then with no key at all if S3 rejects it, so objects
+// written before a rotation or before SSE-C was enabled stay readable.
+// Without SSE-C the request runs once with no key.
+func (b *S3) withCustomerKey(do func(ck *customerKey) error) error {
+	if b.current == nil {
+		return do(nil)
+	}
+	keys := []*customerKey{b.current}
+	if b.previous != nil {
+		keys = append(keys, b.previous)
+	}
+	keys = append(keys, nil)
+
+	var err error
+	for _, ck := range keys {
+		err = do(ck)
+		if err == nil || !isBadRequest(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+func isBadRequest(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "BadRequest", "InvalidRequest", "InvalidArgument", "AccessDenied", "Forbidden":
+		return true
+	}
+	return false
+}
+
+func s3NotFound(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+// PresignGet returns a temporary URL for downloading an object straight from
+// the bucket. Objects encrypted with a customer key can't be presigned because
+// the key would have to be sent by the client.
+func (b *S3) PresignGet(ctx context.Context, key, disposition string, expires time.Duration) (string, error) {
+	if b.enc.Mode == SSEC {
+		return "", ErrPresignUnsupported
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+	if disposition != "" {
+		input.ResponseContentDisposition = aws.String(disposition)
+	}
+	req, err := s3.NewPresignClient(b.client).PresignGetObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
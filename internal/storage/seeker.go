@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadSeeker reads an object through ranged requests, so it can be handed to
+// http.ServeContent to answer Range requests without holding the object in
+// memory. Seeking is free; a new ranged read starts on the first Read after a
+// seek.
+type ReadSeeker struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, backend Backend, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+func (rs *ReadSeeker) Read(p []byte) (int, error) {
+	if rs.offset >= rs.size {
+		return 0, io.EOF
+	}
+	if rs.body == nil {
+		body, err := rs.backend.GetRange(rs.ctx, rs.key, rs.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		rs.body = body
+	}
+	n, err := rs.body.Read(p)
+	rs.offset += int64(n)
+	return n, err
+}
+
+func (rs *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = rs.offset + offset
+	case io.SeekEnd:
+		abs = rs.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	if abs != rs.offset && rs.body != nil {
+		rs.body.Close()
+		rs.body = nil
+	}
+	rs.offset = abs
+	return abs, nil
+}
+
+func (rs *ReadSeeker) Close() error {
+	if rs.body == nil {
+		return nil
+	}
+	err := rs.body.Close()
+	rs.body = nil
+	return err
+}
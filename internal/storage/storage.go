@@ -0,0 +1,52 @@
+// Package storage reads and writes media files on a backend such as the local
+// filesystem or an S3 bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+type PutOptions struct {
+	ContentType string
+	// CacheControl and Metadata are stored with the object by backends that
+	// serve it to clients directly.
+	CacheControl string
+	Metadata     map[string]string
+}
+
+type Backend interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker, opts PutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// GetRange reads length bytes of an object starting at offset. A negative
+	// length reads to the end.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Head(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+	// Rotate re-encrypts a stored object with the backend's current key. It is
+	// a no-op for objects that already use it.
+	Rotate(ctx context.Context, key string) error
+}
+
+// ErrPresignUnsupported is returned by backends that can't hand out a URL
+// clients could use to read an object directly.
+var ErrPresignUnsupported = errors.New("presigned URLs are not supported")
+
+// Presigner is implemented by backends that can give clients a temporary URL
+// to download an object without going through the server. disposition is
+// sent back as the Content-Disposition of the download.
+type Presigner interface {
+	PresignGet(ctx context.Context, key, disposition string, expires time.Duration) (string, error)
+}
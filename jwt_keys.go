@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// loadJWTKeySet reads the keys access tokens are signed with. JWT_SIGNING_KEYS
+// lists id:path pairs of PEM files with the active key first; retired keys
+// can be public keys. Without it, tokens are signed with JWT_SECRET.
+func loadJWTKeySet() (*auth.KeySet, error) {
+	spec := os.Getenv("JWT_SIGNING_KEYS")
+	if spec == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("JWT_SIGNING_KEYS or JWT_SECRET must be set")
+		}
+		return auth.NewHMACKeySet(secret), nil
+	}
+
+	var keys []auth.Key
+	for _, entry := range strings.Split(spec, ",") {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("JWT_SIGNING_KEYS entry %q must look like id:path", entry)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read key %q: %w", id, err)
+		}
+		key, err := auth.ParseKey(id, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewKeySet(keys)
+}
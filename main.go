@@ -5,25 +5,45 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	s3Client         *s3.Client
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
+	db                    database.Store
+	jwtKeys               *auth.KeySet
+	mediaURLKey           []byte
+	platform              string
+	s3Client              *s3.Client
+	localStore            storage.Backend
+	s3Store               storage.Backend
+	cdn                   cdn.Purger
+	s3Encryption          storage.S3Encryption
+	thumbnailBackend      string
+	videoBackend          string
+	filepathRoot          string
+	assetsRoot            string
+	s3Bucket              string
+	s3Region              string
+	s3CfDistribution      string
+	port                  string
+	publicBaseURL         string
+	userStorageQuota      int64
+	videoVersionRetention int
+	trashRetention        time.Duration
+	accessTokenTTL        time.Duration
+	refreshTokenTTL       time.Duration
+	adminEmails           []string
 }
 
 func main() {
@@ -39,9 +59,25 @@ func main() {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = commandMigrate(db, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	err = db.Migrate()
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+
+	jwtKeys, err := loadJWTKeySet()
+	if err != nil {
+		log.Fatalf("Invalid JWT signing keys: %v", err)
+	}
+	mediaURLKey, err := loadMediaURLKey()
+	if err != nil {
+		log.Fatalf("Couldn't make a media URL key: %v", err)
 	}
 
 	platform := os.Getenv("PLATFORM")
@@ -73,29 +109,156 @@ func main() {
 	if s3CfDistribution == "" {
 		log.Fatal("S3_CF_DISTRO environment variable is not set")
 	}
+	s3CfDistributionID := os.Getenv("S3_CF_DISTRO_ID")
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	publicBaseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if publicBaseURL == "" {
+		publicBaseURL = "http://localhost:" + port
+	}
+
+	var userStorageQuota int64
+	if quota := os.Getenv("USER_STORAGE_QUOTA"); quota != "" {
+		userStorageQuota, err = strconv.ParseInt(quota, 10, 64)
+		if err != nil {
+			log.Fatalf("USER_STORAGE_QUOTA must be a number of bytes: %v", err)
+		}
+	}
+
+	videoVersionRetention := 5
+	if retention := os.Getenv("VIDEO_VERSION_RETENTION"); retention != "" {
+		videoVersionRetention, err = strconv.Atoi(retention)
+		if err != nil {
+			log.Fatalf("VIDEO_VERSION_RETENTION must be a number of versions: %v", err)
+		}
+	}
+
+	trashRetentionDays := 30
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		trashRetentionDays, err = strconv.Atoi(days)
+		if err != nil || trashRetentionDays < 0 {
+			log.Fatalf("TRASH_RETENTION_DAYS must be a number of days: %v", err)
+		}
+	}
+
+	accessTokenTTL := 15 * time.Minute
+	if ttl := os.Getenv("ACCESS_TOKEN_TTL"); ttl != "" {
+		accessTokenTTL, err = time.ParseDuration(ttl)
+		if err != nil || accessTokenTTL <= 0 {
+			log.Fatalf("ACCESS_TOKEN_TTL must be a positive duration: %v", err)
+		}
+	}
+
+	refreshTokenTTL := 60 * 24 * time.Hour
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL"); ttl != "" {
+		refreshTokenTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("REFRESH_TOKEN_TTL must be a duration: %v", err)
+		}
+	}
+	if refreshTokenTTL <= accessTokenTTL {
+		log.Fatal("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	var adminEmails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			adminEmails = append(adminEmails, email)
+		}
+	}
+	var scrubInterval time.Duration
+	if interval := os.Getenv("SCRUB_INTERVAL"); interval != "" {
+		scrubInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("SCRUB_INTERVAL must be a duration: %v", err)
+		}
+	}
+	scrubChecksums := os.Getenv("SCRUB_VERIFY_CHECKSUMS") == "true"
+
 	awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
 	if err != nil {
 		log.Fatal(err)
 	}
 	client := s3.NewFromConfig(awsCfg)
 
+	s3Encryption, err := loadS3Encryption()
+	if err != nil {
+		log.Fatalf("Invalid S3 encryption settings: %v", err)
+	}
+	// Files in the bucket are served through the S3_CF_DISTRO distribution,
+	// and CloudFront can't send the customer key S3 needs to read SSE-C
+	// objects, so every one of them would fail to load.
+	if s3Encryption.Mode == storage.SSEC {
+		log.Fatal("S3_SSE=sse-c can't be used because files are served through CloudFront (S3_CF_DISTRO)")
+	}
+	s3Store, err := storage.NewS3(client, s3Bucket, s3Encryption)
+	if err != nil {
+		log.Fatalf("Couldn't set up S3 storage: %v", err)
+	}
+
+	var purger cdn.Purger = cdn.Noop{}
+	if s3CfDistributionID != "" {
+		purger = cdn.NewCloudFront(cloudfront.NewFromConfig(awsCfg), s3CfDistributionID)
+	}
+
+	localKeys, err := loadLocalKeyRing()
+	if err != nil {
+		log.Fatalf("Invalid LOCAL_ENCRYPTION_KEYS: %v", err)
+	}
+
+	thumbnailBackend := os.Getenv("THUMBNAIL_BACKEND")
+	if thumbnailBackend == "" {
+		thumbnailBackend = localBackend
+	}
+	videoBackend := os.Getenv("VIDEO_BACKEND")
+	if videoBackend == "" {
+		videoBackend = s3Backend(s3Bucket)
+	}
+
+	// Assets stored before backends were tracked followed a fixed layout.
+	err = db.SetDefaultAssetBackend(database.AssetCategoryThumbnail, localBackend)
+	if err != nil {
+		log.Fatalf("Couldn't update asset backends: %v", err)
+	}
+	err = db.SetDefaultAssetBackend(database.AssetCategoryVideo, s3Backend(s3Bucket))
+	if err != nil {
+		log.Fatalf("Couldn't update asset backends: %v", err)
+	}
+
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		s3Client:         client,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                    db,
+		jwtKeys:               jwtKeys,
+		mediaURLKey:           mediaURLKey,
+		platform:              platform,
+		s3Client:              client,
+		localStore:            storage.NewLocal(assetsRoot, localKeys),
+		s3Store:               s3Store,
+		cdn:                   purger,
+		s3Encryption:          s3Encryption,
+		thumbnailBackend:      thumbnailBackend,
+		videoBackend:          videoBackend,
+		filepathRoot:          filepathRoot,
+		assetsRoot:            assetsRoot,
+		s3Bucket:              s3Bucket,
+		s3Region:              s3Region,
+		s3CfDistribution:      s3CfDistribution,
+		port:                  port,
+		publicBaseURL:         publicBaseURL,
+		userStorageQuota:      userStorageQuota,
+		videoVersionRetention: videoVersionRetention,
+		trashRetention:        time.Duration(trashRetentionDays) * 24 * time.Hour,
+		accessTokenTTL:        accessTokenTTL,
+		refreshTokenTTL:       refreshTokenTTL,
+		adminEmails:           adminEmails,
+	}
+
+	err = cfg.bootstrapAdmins()
+	if err != nil {
+		log.Fatalf("Couldn't set up admins: %v", err)
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -103,31 +266,86 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
-	mux := http.NewServeMux()
+	for _, name := range []string{thumbnailBackend, videoBackend} {
+		if _, err := cfg.backend(name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(os.Args) > 1 {
+		err = cfg.runCommand(context.Background(), os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if scrubInterval > 0 {
+		go cfg.runScrubber(context.Background(), scrubInterval, scrubChecksums)
+	}
+	if cfg.trashRetention > 0 {
+		go cfg.runTrashPurger(context.Background(), trashPurgeInterval)
+	}
+
+	rt := newRouter()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
-	mux.Handle("/app/", appHandler)
+	rt.Handle("/app/", noAPIKeys, appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	// Files of private and unlisted videos are only served to users who can
+	// see the video, so an API key needs videos:read to fetch them just as it
+	// does for the stream and thumbnail endpoints. Public files are served
+	// without credentials either way.
+	assetsHandler := http.HandlerFunc(cfg.handlerAssetGet)
+	rt.Handle("GET /assets/{key...}", scopeVideosRead, cacheMiddleware(assetsHandler))
 
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	rt.HandleFunc("GET /.well-known/jwks.json", noAPIKeys, cfg.handlerJWKS)
+	rt.HandleFunc("POST /api/login", noAPIKeys, cfg.handlerLogin)
+	rt.HandleFunc("POST /api/refresh", noAPIKeys, cfg.handlerRefresh)
+	rt.HandleFunc("POST /api/revoke", noAPIKeys, cfg.handlerRevoke)
+	rt.Handle("GET /api/sessions", noAPIKeys, requireAuth(cfg.handlerSessionsList))
+	rt.Handle("DELETE /api/sessions", noAPIKeys, requireAuth(cfg.handlerSessionsRevokeAll))
+	rt.Handle("DELETE /api/sessions/{sessionID}", noAPIKeys, requireAuth(cfg.handlerSessionRevoke))
+	rt.Handle("POST /api/api_keys", noAPIKeys, requireAuth(cfg.handlerAPIKeyCreate))
+	rt.Handle("GET /api/api_keys", noAPIKeys, requireAuth(cfg.handlerAPIKeysList))
+	rt.Handle("DELETE /api/api_keys/{keyID}", noAPIKeys, requireAuth(cfg.handlerAPIKeyRevoke))
 
-	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	rt.HandleFunc("POST /api/users", noAPIKeys, cfg.handlerUsersCreate)
+	rt.Handle("GET /api/users/me/usage", scopeAccountRead, requireAuth(cfg.handlerUsageGet))
+	rt.Handle("GET /api/users/me/tags", scopeVideosRead, requireAuth(cfg.handlerUserTagsList))
+	rt.HandleFunc("GET /api/users/{userID}/videos", scopeVideosRead, cfg.handlerUserPublicVideos)
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	rt.Handle("POST /api/videos", scopeVideosWrite, requireAuth(cfg.handlerVideoMetaCreate))
+	rt.Handle("POST /api/thumbnail_upload/{videoID}", scopeVideosWrite, requireAuth(cfg.handlerUploadThumbnail))
+	rt.Handle("POST /api/video_upload/{videoID}", scopeVideosWrite, requireAuth(cfg.handlerUploadVideo))
+	rt.Handle("GET /api/videos", scopeVideosRead, requireAuth(cfg.handlerVideosRetrieve))
+	rt.Handle("GET /api/videos/search", scopeVideosRead, requireAuth(cfg.handlerVideosSearch))
+	rt.Handle("GET /api/videos/trash", scopeVideosRead, requireAuth(cfg.handlerTrashList))
+	rt.Handle("POST /api/videos/trash/{videoID}/restore", scopeVideosWrite, requireAuth(cfg.handlerTrashRestore))
+	rt.Handle("DELETE /api/videos/trash/{videoID}", scopeVideosWrite, requireAuth(cfg.handlerTrashDelete))
+	rt.HandleFunc("GET /api/videos/{videoID}", scopeVideosRead, cfg.handlerVideoGet)
+	rt.Handle("PATCH /api/videos/{videoID}", scopeVideosWrite, requireAuth(cfg.handlerVideoMetaUpdate))
+	rt.Handle("DELETE /api/videos/{videoID}", scopeVideosWrite, requireAuth(cfg.handlerVideoMetaDelete))
+	rt.HandleFunc("GET /api/videos/{videoID}/stream", scopeVideosRead, cfg.handlerVideoStream)
+	rt.HandleFunc("GET /api/videos/{videoID}/thumbnail", scopeVideosRead, cfg.handlerVideoThumbnail)
+	rt.HandleFunc("GET /api/videos/{videoID}/download", scopeVideosRead, cfg.handlerVideoDownload)
+	rt.Handle("GET /api/videos/{videoID}/tags", scopeVideosRead, requireAuth(cfg.handlerVideoTagsList))
+	rt.Handle("PUT /api/videos/{videoID}/tags/{tag}", scopeVideosWrite, requireAuth(cfg.handlerVideoTagAdd))
+	rt.Handle("DELETE /api/videos/{videoID}/tags/{tag}", scopeVideosWrite, requireAuth(cfg.handlerVideoTagRemove))
+	rt.Handle("GET /api/videos/{videoID}/versions", scopeVideosRead, requireAuth(cfg.handlerVideoVersionsList))
+	rt.Handle("POST /api/videos/{videoID}/versions/{versionID}/rollback", scopeVideosWrite, requireAuth(cfg.handlerVideoVersionRollback))
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	rt.Handle("POST /admin/reset", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerReset))
+	rt.Handle("GET /admin/asset_health", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerAssetHealthReport))
+	rt.Handle("GET /admin/users", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerAdminUsersList))
+	rt.Handle("PUT /admin/users/{userID}/role", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerAdminUserRoleUpdate))
+	rt.Handle("POST /admin/users/{userID}/disable", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerAdminUserDisable))
+	rt.Handle("POST /admin/users/{userID}/enable", noAPIKeys, requireRole(database.RoleAdmin, cfg.handlerAdminUserEnable))
+	rt.Handle("POST /admin/videos/{videoID}/takedown", noAPIKeys, requireRole(database.RoleModerator, cfg.handlerAdminVideoTakeDown))
+	rt.Handle("DELETE /admin/videos/{videoID}/takedown", noAPIKeys, requireRole(database.RoleModerator, cfg.handlerAdminVideoReinstate))
 
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: cfg.authMiddleware(rt),
 	}
 
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// mediaURLExpiry is how long the signed links to the files of videos that
+// aren't public keep working.
+const mediaURLExpiry = time.Hour
+
+// loadMediaURLKey reads the key media URLs are signed with from
+// MEDIA_URL_SECRET. Without it a random key is used, and signed URLs stop
+// working when the server restarts.
+func loadMediaURLKey() ([]byte, error) {
+	if secret := os.Getenv("MEDIA_URL_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+	log.Print("MEDIA_URL_SECRET isn't set, signing media URLs with a random key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signedMediaURL returns a link to path on PUBLIC_BASE_URL that works
+// without credentials until mediaURLExpiry.
+func (cfg *apiConfig) signedMediaURL(path string) string {
+	query := auth.SignMediaURL(cfg.mediaURLKey, path, time.Now().Add(mediaURLExpiry))
+	return fmt.Sprintf("%s%s?%s", cfg.publicBaseURL, path, query.Encode())
+}
+
+// videoResponse is a video as it is sent to clients. Only public videos link
+// straight to their files, which may be cached by the CDN. The others link
+// to the stream and thumbnail endpoints with a short-lived signature, so a
+// link that is shared or leaked stops working.
+func (cfg *apiConfig) videoResponse(video database.Video) database.Video {
+	if video.Visibility == database.VideoPublic && video.TakenDownAt == nil {
+		return video
+	}
+	if video.VideoURL != nil {
+		url := cfg.signedMediaURL(fmt.Sprintf("/api/videos/%s/stream", video.ID))
+		video.VideoURL = &url
+	}
+	if video.ThumbnailURL != nil {
+		url := cfg.signedMediaURL(fmt.Sprintf("/api/videos/%s/thumbnail", video.ID))
+		video.ThumbnailURL = &url
+	}
+	return video
+}
+
+func (cfg *apiConfig) videosResponse(videos []database.Video) []database.Video {
+	response := make([]database.Video, len(videos))
+	for i, video := range videos {
+		response[i] = cfg.videoResponse(video)
+	}
+	return response
+}
+
+// loadMediaVideo is loadVideo for the endpoints that serve a video's files.
+// Requests with a valid signed URL from videoResponse may fetch them without
+// credentials, as long as the video hasn't since been moved to the trash or
+// taken down.
+func (cfg *apiConfig) loadMediaVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	err := auth.VerifyMediaURL(cfg.mediaURLKey, r.URL.Path, r.URL.Query())
+	if errors.Is(err, auth.ErrMediaURLUnsigned) {
+		return cfg.loadVideo(w, r, videoView)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Media URL isn't valid", err)
+		return database.Video{}, false
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || video.TakenDownAt != nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// hiddenKeyPrefix is where the files of videos that aren't public are kept in
+// the bucket behind the CDN. Each file gets a random directory under it, so
+// nobody can guess its URL, and it is only ever served through the signed
+// stream and thumbnail endpoints.
+const hiddenKeyPrefix = "hidden/"
+
+func isHiddenKey(key string) bool {
+	return strings.HasPrefix(key, hiddenKeyPrefix)
+}
+
+func hiddenKey(key string) string {
+	return hiddenKeyPrefix + strings.ReplaceAll(uuid.NewString(), "-", "") + "/" + key
+}
+
+// publishedKey is the key a hidden file is published at again.
+func publishedKey(key string) string {
+	_, published, _ := strings.Cut(strings.TrimPrefix(key, hiddenKeyPrefix), "/")
+	return published
+}
+
+// syncVideoMedia moves a video's files in the bucket behind the CDN to where
+// they belong: at their published keys while the video is public, and under
+// hiddenKeyPrefix otherwise. Purging the CDN alone isn't enough to hide a
+// file, since the next request for its old URL would fetch it again, so
+// files are moved away first and the old keys purged after. Files with the
+// same content as another video's stay where they are for that video. It is
+// safe to call again after a failure.
+func (cfg *apiConfig) syncVideoMedia(ctx context.Context, videoID uuid.UUID) error {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+	public := video.ID != uuid.Nil && video.Visibility == database.VideoPublic && video.TakenDownAt == nil
+	return cfg.moveVideoMedia(ctx, videoID, public)
+}
+
+// moveVideoMedia is syncVideoMedia for a video that is about to become public
+// or stop being public.
+func (cfg *apiConfig) moveVideoMedia(ctx context.Context, videoID uuid.UUID, public bool) error {
+	assets, err := cfg.db.GetVideoAssets(videoID)
+	if err != nil {
+		return err
+	}
+	moves := []database.AssetMove{}
+	moved := []database.Asset{}
+	for _, asset := range assets {
+		if asset.Backend != s3Backend(cfg.s3Bucket) || isHiddenKey(asset.StorageKey) != public {
+			continue
+		}
+		key := hiddenKey(asset.StorageKey)
+		if public {
+			key = publishedKey(asset.StorageKey)
+		}
+		checksum, err := copyObject(ctx, cfg.s3Store, cfg.s3Store, asset, key)
+		if err != nil {
+			return fmt.Errorf("couldn't move %s: %w", asset.StorageKey, err)
+		}
+		moves = append(moves, database.AssetMove{
+			AssetID:    asset.ID,
+			Backend:    asset.Backend,
+			StorageKey: key,
+			Checksum:   checksum,
+			OldURL:     cfg.assetURL(asset),
+			NewURL:     cfg.backendURL(asset.Backend, key),
+			VideoID:    videoID,
+		})
+		moved = append(moved, asset)
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+	if err := cfg.db.MoveAssets(moves); err != nil {
+		return err
+	}
+
+	purge := []database.Asset{}
+	for _, asset := range moved {
+		if err := cfg.deleteAssetObject(ctx, asset); err != nil {
+			return fmt.Errorf("couldn't delete %s: %w", asset.StorageKey, err)
+		}
+		if !isHiddenKey(asset.StorageKey) {
+			purge = append(purge, asset)
+		}
+	}
+	return cfg.purgeCDN(ctx, purge)
+}
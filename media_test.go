@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestSignedMediaURL(t *testing.T) {
+	cfg := &apiConfig{mediaURLKey: []byte("test key"), publicBaseURL: "https://tubely.example.com"}
+	got := cfg.signedMediaURL("/api/videos/1/stream")
+	if !strings.HasPrefix(got, "https://tubely.example.com/api/videos/1/stream?") {
+		t.Errorf("signedMediaURL = %q, want a URL on PUBLIC_BASE_URL", got)
+	}
+}
+
+func TestLoadMediaVideoWithSignedURL(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &apiConfig{db: db, mediaURLKey: []byte("test key"), publicBaseURL: "http://localhost:8091"}
+	user, err := db.CreateUser(database.CreateUserParams{Email: "a@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	newVideo := func() database.Video {
+		video, err := db.CreateVideo(database.CreateVideoParams{UserID: user.ID, Title: "cats", Visibility: database.VideoUnlisted})
+		if err != nil {
+			t.Fatalf("CreateVideo: %v", err)
+		}
+		return video
+	}
+	// load requests a video's stream through a signed URL handed out before
+	// the video changed, without credentials.
+	load := func(signed string) int {
+		u, err := url.Parse(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+		r.SetPathValue("videoID", strings.Split(u.Path, "/")[3])
+		w := httptest.NewRecorder()
+		if _, ok := cfg.loadMediaVideo(w, r); ok {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+	streamURL := func(video database.Video) string {
+		return cfg.signedMediaURL("/api/videos/" + video.ID.String() + "/stream")
+	}
+
+	video := newVideo()
+	if code := load(streamURL(video)); code != http.StatusOK {
+		t.Errorf("signed URL of a visible video = %d, want 200", code)
+	}
+
+	trashed := newVideo()
+	signed := streamURL(trashed)
+	if err := db.TrashVideo(trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := load(signed); code != http.StatusNotFound {
+		t.Errorf("signed URL of a trashed video = %d, want 404", code)
+	}
+
+	takenDown := newVideo()
+	signed = streamURL(takenDown)
+	if err := db.TakeDownVideo(takenDown.ID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if code := load(signed); code != http.StatusNotFound {
+		t.Errorf("signed URL of a taken down video = %d, want 404", code)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	scopeVideosRead  = "videos:read"
+	scopeVideosWrite = "videos:write"
+	scopeAccountRead = "account:read"
+)
+
+var apiKeyScopes = []string{scopeVideosRead, scopeVideosWrite, scopeAccountRead}
+
+var errNotAuthenticated = errors.New("request isn't authenticated")
+
+// principal is who a request is authenticated as.
+type principal struct {
+	UserID uuid.UUID
+	// SessionID is set for requests made with an access token.
+	SessionID string
+	// APIKey is set for requests made with an API key.
+	APIKey *database.APIKey
+	Role   database.Role
+}
+
+type principalContextKey struct{}
+
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(principal)
+	return p, ok
+}
+
+// requestUserID returns the user a request is authenticated as, or uuid.Nil
+// for anonymous requests. Handlers behind requireAuth always have a user.
+func requestUserID(r *http.Request) uuid.UUID {
+	p, _ := principalFromContext(r.Context())
+	return p.UserID
+}
+
+// requireAuth rejects requests that authMiddleware didn't authenticate.
+func requireAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := principalFromContext(r.Context()); !ok {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't authenticate request", errNotAuthenticated)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireRole rejects requests from users whose role doesn't include role.
+func requireRole(role database.Role, next http.HandlerFunc) http.Handler {
+	return requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := principalFromContext(r.Context())
+		if !p.Role.Includes(role) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("This requires the %s role", role), nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// authMiddleware authenticates requests that carry a Bearer access token or an
+// ApiKey and puts who they are authenticated as in the request context.
+// Requests with credentials that don't check out, or from disabled users, are
+// rejected here; requests without any are passed on for handlers to decide.
+func (cfg *apiConfig) authMiddleware(next *router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// These take a refresh token rather than an access token.
+		if r.URL.Path == "/api/refresh" || r.URL.Path == "/api/revoke" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var p principal
+		if key, err := auth.GetAPIKey(r.Header); err == nil {
+			var ok bool
+			p, ok = cfg.authenticateAPIKey(w, r, key, next)
+			if !ok {
+				return
+			}
+		} else {
+			token, err := auth.GetBearerToken(r.Header)
+			if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+				return
+			}
+			accessToken, err := cfg.authenticateAccessToken(token)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+				return
+			}
+			p = principal{UserID: accessToken.UserID, SessionID: accessToken.SessionID}
+		}
+
+		user, err := cfg.db.GetUser(p.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if user == nil {
+			respondWithError(w, http.StatusUnauthorized, "User doesn't exist", nil)
+			return
+		}
+		if user.DisabledAt != nil {
+			respondWithError(w, http.StatusForbidden, "Account is disabled", nil)
+			return
+		}
+		p.Role = user.Role
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, p)))
+	})
+}
+
+// authenticateAPIKey checks an API key is live and has the scope routes
+// declares for the request. It writes the error response and returns false
+// when it isn't.
+func (cfg *apiConfig) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string, routes *router) (principal, bool) {
+	apiKey, err := cfg.db.GetAPIKey(key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API key", err)
+		return principal{}, false
+	}
+	if apiKey.ID == uuid.Nil || apiKey.RevokedAt != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid API key", nil)
+		return principal{}, false
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "API key expired", nil)
+		return principal{}, false
+	}
+
+	scope, ok := routes.apiKeyScope(r)
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "API keys can't be used for this endpoint", nil)
+		return principal{}, false
+	}
+	if !slices.Contains(apiKey.Scopes, scope) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("API key doesn't have the %s scope", scope), nil)
+		return principal{}, false
+	}
+
+	if err := cfg.db.TouchAPIKey(apiKey.ID); err != nil {
+		log.Printf("Couldn't record use of API key %s: %v", apiKey.ID, err)
+	}
+	return principal{UserID: apiKey.UserID, APIKey: &apiKey}, true
+}
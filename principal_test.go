@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func createTestAPIKey(t *testing.T, cfg *apiConfig, userID uuid.UUID, expiresAt *time.Time, scopes ...string) (string, database.APIKey) {
+	t.Helper()
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := cfg.db.CreateAPIKey(database.CreateAPIKeyParams{UserID: userID, Name: "test", Key: key, Scopes: scopes, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return key, apiKey
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	cfg, user, login := newRefreshTestConfig(t)
+	accessToken, err := cfg.makeAccessToken(user.ID, login.FamilyID)
+	if err != nil {
+		t.Fatalf("makeAccessToken: %v", err)
+	}
+
+	readKey, _ := createTestAPIKey(t, cfg, user.ID, nil, scopeVideosRead)
+	expired := time.Now().Add(-time.Minute).UTC()
+	expiredKey, _ := createTestAPIKey(t, cfg, user.ID, &expired, scopeVideosRead)
+	revokedKey, revoked := createTestAPIKey(t, cfg, user.ID, nil, scopeVideosRead)
+	if err := cfg.db.RevokeAPIKey(revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	disabledUser, err := cfg.db.CreateUser(database.CreateUserParams{Email: "b@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	disabledKey, _ := createTestAPIKey(t, cfg, disabledUser.ID, nil, scopeVideosRead)
+	disabledLogin := createTestRefreshToken(t, cfg, disabledUser.ID, time.Now().Add(time.Hour))
+	disabledToken, err := cfg.makeAccessToken(disabledUser.ID, disabledLogin.FamilyID)
+	if err != nil {
+		t.Fatalf("makeAccessToken: %v", err)
+	}
+	if err := cfg.db.SetUserDisabled(disabledUser.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+
+	var got principal
+	var authenticated bool
+	record := func(w http.ResponseWriter, r *http.Request) {
+		got, authenticated = principalFromContext(r.Context())
+	}
+	rt := newRouter()
+	rt.HandleFunc("GET /read", scopeVideosRead, record)
+	rt.HandleFunc("POST /write", scopeVideosWrite, record)
+	rt.HandleFunc("GET /no_keys", noAPIKeys, record)
+	handler := cfg.authMiddleware(rt)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		authHeader []string
+		wantStatus int
+		// wantAPIKey is whether the request should be authenticated with an
+		// API key rather than an access token; it is ignored for requests
+		// that aren't authenticated.
+		wantAPIKey bool
+		wantUser   uuid.UUID
+	}{
+		{name: "anonymous", method: "GET", path: "/read", wantStatus: http.StatusOK},
+		{name: "access token", method: "GET", path: "/read", authHeader: []string{"Bearer " + accessToken}, wantStatus: http.StatusOK, wantUser: user.ID},
+		{name: "access token on a route without a scope", method: "GET", path: "/no_keys", authHeader: []string{"Bearer " + accessToken}, wantStatus: http.StatusOK, wantUser: user.ID},
+		{name: "invalid access token", method: "GET", path: "/read", authHeader: []string{"Bearer not-a-token"}, wantStatus: http.StatusUnauthorized},
+		{name: "access token of a disabled user", method: "GET", path: "/read", authHeader: []string{"Bearer " + disabledToken}, wantStatus: http.StatusForbidden},
+		{name: "API key with the scope", method: "GET", path: "/read", authHeader: []string{"ApiKey " + readKey}, wantStatus: http.StatusOK, wantAPIKey: true, wantUser: user.ID},
+		{name: "API key missing the scope", method: "POST", path: "/write", authHeader: []string{"ApiKey " + readKey}, wantStatus: http.StatusForbidden},
+		{name: "API key on a route without a scope", method: "GET", path: "/no_keys", authHeader: []string{"ApiKey " + readKey}, wantStatus: http.StatusForbidden},
+		{name: "API key on an unknown route", method: "GET", path: "/missing", authHeader: []string{"ApiKey " + readKey}, wantStatus: http.StatusForbidden},
+		{name: "unknown API key", method: "GET", path: "/read", authHeader: []string{"ApiKey tubely_unknown"}, wantStatus: http.StatusUnauthorized},
+		{name: "expired API key", method: "GET", path: "/read", authHeader: []string{"ApiKey " + expiredKey}, wantStatus: http.StatusUnauthorized},
+		{name: "revoked API key", method: "GET", path: "/read", authHeader: []string{"ApiKey " + revokedKey}, wantStatus: http.StatusUnauthorized},
+		{name: "API key of a disabled user", method: "GET", path: "/read", authHeader: []string{"ApiKey " + disabledKey}, wantStatus: http.StatusForbidden},
+		{name: "API key takes precedence over a valid access token", method: "GET", path: "/read", authHeader: []string{"ApiKey " + revokedKey, "Bearer " + accessToken}, wantStatus: http.StatusUnauthorized},
+		{name: "API key takes precedence over an invalid access token", method: "GET", path: "/read", authHeader: []string{"ApiKey " + readKey, "Bearer not-a-token"}, wantStatus: http.StatusOK, wantAPIKey: true, wantUser: user.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, authenticated = principal{}, false
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for _, value := range tt.authHeader {
+				r.Header.Add("Authorization", value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if authenticated != (tt.wantUser != uuid.Nil) {
+				t.Fatalf("authenticated = %v, want %v", authenticated, tt.wantUser != uuid.Nil)
+			}
+			if got.UserID != tt.wantUser {
+				t.Errorf("UserID = %v, want %v", got.UserID, tt.wantUser)
+			}
+			if (got.APIKey != nil) != tt.wantAPIKey {
+				t.Errorf("authenticated with API key = %v, want %v", got.APIKey != nil, tt.wantAPIKey)
+			}
+		})
+	}
+}
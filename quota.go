@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// enforceStorageQuota checks whether a user can store size more bytes. If not,
+// it writes the error response and returns false so the caller can bail out
+// before doing any processing. A quota of zero means unlimited.
+func (cfg *apiConfig) enforceStorageQuota(w http.ResponseWriter, userID uuid.UUID, size int64) bool {
+	if cfg.userStorageQuota <= 0 || size <= 0 {
+		return true
+	}
+
+	if size > cfg.userStorageQuota {
+		msg := fmt.Sprintf("Upload of %d bytes exceeds the storage quota of %d bytes", size, cfg.userStorageQuota)
+		respondWithError(w, http.StatusRequestEntityTooLarge, msg, nil)
+		return false
+	}
+
+	usage, err := cfg.db.GetStorageUsage(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return false
+	}
+	if usage.TotalBytes+size > cfg.userStorageQuota {
+		msg := fmt.Sprintf("Storage quota exceeded: %d of %d bytes used", usage.TotalBytes, cfg.userStorageQuota)
+		respondWithError(w, http.StatusRequestEntityTooLarge, msg, nil)
+		return false
+	}
+
+	return true
+}
+
+// createAssetWithinQuota records a file that has already been stored, checking
+// the quota against its final size. The upload's size checked up front can
+// differ after processing, and other uploads may have finished since. If the
+// file doesn't fit, it is deleted again and the error response is written.
+func (cfg *apiConfig) createAssetWithinQuota(ctx context.Context, w http.ResponseWriter, params database.CreateAssetParams) (database.Asset, bool) {
+	asset, err := cfg.db.CreateAssetWithinQuota(params, cfg.userStorageQuota)
+	if errors.Is(err, database.ErrStorageQuotaExceeded) {
+		if err := cfg.deleteAssetObject(ctx, database.Asset{CreateAssetParams: params}); err != nil {
+			log.Printf("Couldn't delete %s after it went over the quota: %v", params.StorageKey, err)
+		}
+		msg := fmt.Sprintf("Storing %d more bytes would exceed the storage quota of %d bytes", params.Size, cfg.userStorageQuota)
+		respondWithError(w, http.StatusRequestEntityTooLarge, msg, err)
+		return database.Asset{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record asset", err)
+		return database.Asset{}, false
+	}
+	return asset, true
+}
@@ -1,7 +1,16 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
 
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerReset deletes everything except the accounts of the users listed in
+// ADMIN_EMAILS, which are created again as admins with the same password.
+// Signing up doesn't make anyone an admin, so without them no one could be
+// one again until the server restarted.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
 		w.WriteHeader(http.StatusForbidden)
@@ -9,11 +18,29 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var admins []database.CreateUserParams
+	for _, email := range cfg.adminEmails {
+		user, err := cfg.db.GetUserByEmail(email)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if user.ID != uuid.Nil {
+			admins = append(admins, database.CreateUserParams{Email: user.Email, Password: user.Password, Role: database.RoleAdmin})
+		}
+	}
+
 	err := cfg.db.Reset()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't reset database", err)
 		return
 	}
+	for _, admin := range admins {
+		if _, err := cfg.db.CreateUser(admin); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't restore admin account", err)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Database reset to initial state"))
 }
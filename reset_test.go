@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerResetKeepsAdmins(t *testing.T) {
+	cfg, admin, _ := newRefreshTestConfig(t)
+	cfg.platform = "dev"
+	cfg.adminEmails = []string{admin.Email, "missing@example.com"}
+	if err := cfg.bootstrapAdmins(); err != nil {
+		t.Fatalf("bootstrapAdmins: %v", err)
+	}
+	if _, err := cfg.db.CreateUser(database.CreateUserParams{Email: "b@example.com", Password: "hash"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	cfg.handlerReset(w, httptest.NewRequest(http.MethodPost, "/admin/reset", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	got, err := cfg.db.GetUserByEmail(admin.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Role != database.RoleAdmin || got.Password != admin.Password {
+		t.Errorf("admin after reset: role %s, password %q, want admin and %q", got.Role, got.Password, admin.Password)
+	}
+	for _, email := range []string{"b@example.com", "missing@example.com"} {
+		if user, err := cfg.db.GetUserByEmail(email); err != nil || user.ID != uuid.Nil {
+			t.Errorf("%s after reset: %+v, %v", email, user, err)
+		}
+	}
+}
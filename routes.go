@@ -0,0 +1,42 @@
+package main
+
+import "net/http"
+
+// noAPIKeys is the scope of routes API keys can't be used for.
+const noAPIKeys = ""
+
+// router is a ServeMux that also records the API key scope each route needs,
+// so scopes are declared next to the routes they guard. API keys are refused
+// for any route registered without one.
+type router struct {
+	mux    *http.ServeMux
+	scopes map[string]string
+}
+
+func newRouter() *router {
+	return &router{mux: http.NewServeMux(), scopes: map[string]string{}}
+}
+
+func (rt *router) Handle(pattern, scope string, handler http.Handler) {
+	rt.mux.Handle(pattern, handler)
+	if scope != noAPIKeys {
+		rt.scopes[pattern] = scope
+	}
+}
+
+func (rt *router) HandleFunc(pattern, scope string, handler http.HandlerFunc) {
+	rt.Handle(pattern, scope, handler)
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// apiKeyScope is the scope an API key needs for the route a request matches.
+// It returns false for routes API keys can't be used for, including requests
+// that match no route.
+func (rt *router) apiKeyScope(r *http.Request) (string, bool) {
+	_, pattern := rt.mux.Handler(r)
+	scope, ok := rt.scopes[pattern]
+	return scope, ok
+}
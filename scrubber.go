@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// runScrubber checks every stored asset once per interval until ctx is done.
+func (cfg *apiConfig) runScrubber(ctx context.Context, interval time.Duration, verifyChecksums bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.scrubAssets(ctx, verifyChecksums); err != nil {
+				log.Printf("Asset scrub failed: %v", err)
+			}
+		}
+	}
+}
+
+// scrubAssets checks that every asset still exists on its backend with the
+// recorded size and, when verifyChecksums is set, reads it back to compare
+// its checksum. The outcome for each asset is recorded in asset_health.
+func (cfg *apiConfig) scrubAssets(ctx context.Context, verifyChecksums bool) error {
+	counts := map[database.AssetHealthStatus]int{}
+	after := uuid.Nil
+	for {
+		assets, err := cfg.db.GetAssetsPage(after, commandBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(assets) == 0 {
+			break
+		}
+		after = assets[len(assets)-1].ID
+
+		for _, asset := range assets {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			health := cfg.checkAsset(ctx, asset, verifyChecksums)
+			if err := cfg.db.SetAssetHealth(health); err != nil {
+				return err
+			}
+			counts[health.Status]++
+		}
+	}
+	log.Printf("Asset scrub finished: %v", counts)
+	return nil
+}
+
+func (cfg *apiConfig) checkAsset(ctx context.Context, asset database.Asset, verifyChecksum bool) database.AssetHealth {
+	health := database.AssetHealth{
+		AssetID:   asset.ID,
+		Status:    database.AssetHealthOK,
+		CheckedAt: time.Now().UTC(),
+	}
+
+	store, err := cfg.backend(asset.Backend)
+	if err != nil {
+		health.Status = database.AssetHealthError
+		health.Detail = err.Error()
+		return health
+	}
+
+	obj, err := store.Head(ctx, asset.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		health.Status = database.AssetHealthMissing
+		return health
+	}
+	if err != nil {
+		health.Status = database.AssetHealthError
+		health.Detail = err.Error()
+		return health
+	}
+	if obj.Size != asset.Size {
+		health.Status = database.AssetHealthSizeMismatch
+		health.Detail = fmt.Sprintf("stored object has %d bytes, expected %d", obj.Size, asset.Size)
+		return health
+	}
+
+	if !verifyChecksum || asset.Checksum == "" {
+		return health
+	}
+	checksum, err := hashObject(ctx, store, asset.StorageKey)
+	if err != nil {
+		health.Status = database.AssetHealthError
+		health.Detail = err.Error()
+		return health
+	}
+	if checksum != asset.Checksum {
+		health.Status = database.AssetHealthChecksumMismatch
+		health.Detail = fmt.Sprintf("stored object has checksum %s, expected %s", checksum, asset.Checksum)
+	}
+	return health
+}
+
+func (cfg *apiConfig) commandScrub(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	verifyChecksums := flags.Bool("checksums", false, "read every object back and verify its checksum")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return cfg.scrubAssets(ctx, *verifyChecksums)
+}
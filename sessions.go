@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+var errSessionEnded = errors.New("session has ended")
+
+// makeAccessToken issues an access JWT for a session. Access tokens are
+// short-lived, and clients use their refresh token to get new ones.
+func (cfg *apiConfig) makeAccessToken(userID uuid.UUID, sessionID string) (string, error) {
+	return auth.MakeJWT(userID, sessionID, cfg.jwtKeys, cfg.accessTokenTTL)
+}
+
+// authenticateAccessToken validates an access JWT and checks the session it
+// was issued for hasn't been revoked, so logging a session out locks out its
+// access tokens straight away rather than when they expire.
+func (cfg *apiConfig) authenticateAccessToken(token string) (auth.AccessToken, error) {
+	accessToken, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+	if accessToken.SessionID == "" {
+		return auth.AccessToken{}, errSessionEnded
+	}
+	active, err := cfg.db.IsSessionActive(accessToken.UserID, accessToken.SessionID)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+	if !active {
+		return auth.AccessToken{}, errSessionEnded
+	}
+	return accessToken, nil
+}
+
+// clientIP is the address a request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const trashPurgeInterval = time.Hour
+
+// runTrashPurger empties videos out of the trash once they've been there for
+// longer than the retention period, checking once per interval until ctx is
+// done.
+func (cfg *apiConfig) runTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.purgeTrash(ctx); err != nil {
+				log.Printf("Trash purge failed: %v", err)
+			}
+		}
+	}
+}
+
+// purgeTrash deletes every video that was trashed more than trashRetention
+// ago, along with its files. A retention of zero keeps them forever.
+func (cfg *apiConfig) purgeTrash(ctx context.Context) error {
+	if cfg.trashRetention <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-cfg.trashRetention)
+	purged := 0
+	for {
+		videos, err := cfg.db.GetVideosTrashedBefore(cutoff, commandBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(videos) == 0 {
+			break
+		}
+		for _, video := range videos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := cfg.purgeVideo(ctx, video); err != nil {
+				return err
+			}
+			purged++
+		}
+	}
+	log.Printf("Trash purge finished: deleted %d videos", purged)
+	return nil
+}
+
+// purgeVideo deletes a video for good. Its files are removed after the row,
+// so a failure there leaves unreferenced files rather than a broken video.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, video database.Video) error {
+	if err := cfg.db.DeleteVideo(video.ID); err != nil {
+		return err
+	}
+	if err := cfg.deleteVideoAssets(ctx, video.ID, "", uuid.Nil); err != nil {
+		log.Printf("Couldn't clean up assets for video %s: %v", video.ID, err)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) commandPurgeTrash(ctx context.Context) error {
+	return cfg.purgeTrash(ctx)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// canViewVideo reports whether a user, or uuid.Nil for anonymous requests,
+// may see a video. Owners see their own videos; anyone sees unlisted and
+// public ones that haven't been taken down. Nobody sees a video in the trash
+// outside of the trash endpoints.
+func canViewVideo(video database.Video, userID uuid.UUID) bool {
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		return false
+	}
+	if video.UserID == userID {
+		return true
+	}
+	return video.TakenDownAt == nil && video.Visibility != database.VideoPrivate
+}
+
+func parseVideoVisibility(s string) (database.VideoVisibility, error) {
+	visibility := database.VideoVisibility(s)
+	if !visibility.Valid() {
+		return "", fmt.Errorf("visibility must be private, unlisted or public")
+	}
+	return visibility, nil
+}
+
+type videoAccess int
+
+const (
+	// videoView is allowed for anyone canViewVideo lets see the video.
+	videoView videoAccess = iota
+	// videoOwn is only allowed for the video's owner.
+	videoOwn
+)
+
+// loadVideo gets the video named by the request's videoID path value and
+// checks the requester has access to it. Videos the requester can't see are
+// reported as not found, and ones they can see but don't own as forbidden. It
+// writes the error response and returns false when access is denied.
+func (cfg *apiConfig) loadVideo(w http.ResponseWriter, r *http.Request, access videoAccess) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	userID := requestUserID(r)
+	if !canViewVideo(video, userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if access == videoOwn && video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Only the owner of this video can do that", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// reloadVideo gets a video again after a handler has written to it, so the
+// response shows what is stored now, including changes made by other
+// requests since it was loaded.
+func (cfg *apiConfig) reloadVideo(w http.ResponseWriter, videoID uuid.UUID) (database.Video, bool) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// loadTrashedVideo is loadVideo for videos in the trash, which only their
+// owner can see.
+func (cfg *apiConfig) loadTrashedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetTrashedVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || video.UserID != requestUserID(r) {
+		respondWithError(w, http.StatusNotFound, "Video isn't in the trash", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
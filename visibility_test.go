@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestCanViewVideo(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	now := time.Now()
+	video := func(visibility database.VideoVisibility, deleted, takenDown bool) database.Video {
+		v := database.Video{ID: uuid.New()}
+		v.UserID = owner
+		v.Visibility = visibility
+		if deleted {
+			v.DeletedAt = &now
+		}
+		if takenDown {
+			v.TakenDownAt = &now
+		}
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		video  database.Video
+		userID uuid.UUID
+		want   bool
+	}{
+		{"owner, private", video(database.VideoPrivate, false, false), owner, true},
+		{"other user, private", video(database.VideoPrivate, false, false), other, false},
+		{"other user, unlisted", video(database.VideoUnlisted, false, false), other, true},
+		{"anonymous, public", video(database.VideoPublic, false, false), uuid.Nil, true},
+		{"owner, trashed", video(database.VideoPublic, true, false), owner, false},
+		{"other user, trashed", video(database.VideoPublic, true, false), other, false},
+		{"owner, taken down", video(database.VideoPrivate, false, true), owner, true},
+		// A takedown hides the video even if its visibility was changed back.
+		{"other user, taken down but public", video(database.VideoPublic, false, true), other, false},
+		{"anonymous, taken down but unlisted", video(database.VideoUnlisted, false, true), uuid.Nil, false},
+		{"missing video", database.Video{}, uuid.Nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canViewVideo(tt.video, tt.userID); got != tt.want {
+				t.Errorf("canViewVideo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}